@@ -0,0 +1,117 @@
+package ingen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// AnomaliesFileName is the name of the ground truth file written to the database directory
+// when series are generated by an AnomalySequence.
+const AnomaliesFileName = "ingen-anomalies.json"
+
+// Anomaly types injected into the values of a series.
+const (
+	AnomalySpike      = "spike"       // a single value increased by the magnitude
+	AnomalyDrop       = "drop"        // a single value decreased by the magnitude
+	AnomalyLevelShift = "level-shift" // values increased by the magnitude for a window
+	AnomalyFlatline   = "flatline"    // values held at the first value of a window
+	AnomalyMissing    = "missing"     // values of a window removed
+)
+
+// Anomaly is an anomaly injected into the values of a series. Start and End are the
+// times of the first and last values affected.
+type Anomaly struct {
+	Type       string
+	Start, End int64
+}
+
+// AnomalySequence is implemented by values sequences which inject anomalies into the
+// values of each series. Anomalies returns the anomalies of the values produced since
+// the last call to Reset.
+type AnomalySequence interface {
+	Anomalies() []Anomaly
+}
+
+// GroundTruthAnomaly describes an anomaly of a series in the ground truth file.
+type GroundTruthAnomaly struct {
+	RetentionPolicy string    `json:"retention_policy"`
+	Shard           uint64    `json:"shard"`
+	Series          string    `json:"series"`
+	Field           string    `json:"field"`
+	Type            string    `json:"type"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+}
+
+// ReadAnomalies reads the ground truth file from the database directory dbPath.
+func ReadAnomalies(dbPath string) ([]GroundTruthAnomaly, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dbPath, AnomaliesFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var a []GroundTruthAnomaly
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// recordAnomalies records the anomalies of the series key of shard id.
+func (g *Generator) recordAnomalies(id uint64, seriesKey, field []byte, anomalies []Anomaly) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.anomalies == nil {
+		g.anomalies = []GroundTruthAnomaly{}
+	}
+	for _, a := range anomalies {
+		g.anomalies = append(g.anomalies, GroundTruthAnomaly{
+			Shard:     id,
+			Series:    string(seriesKey),
+			Field:     string(field),
+			Type:      a.Type,
+			StartTime: time.Unix(0, a.Start).UTC(),
+			EndTime:   time.Unix(0, a.End).UTC(),
+		})
+	}
+}
+
+// writeAnomalies writes the recorded anomalies of the retention policies rps to the
+// ground truth file of the database directory dbPath, ordered by shard, series and time.
+func (g *Generator) writeAnomalies(dbPath string, rps []RetentionPolicy) error {
+	rpOf := make(map[uint64]string)
+	for _, rp := range rps {
+		for _, sgi := range rp.Groups {
+			for _, sh := range sgi.Shards {
+				rpOf[sh.ID] = rp.Name
+			}
+		}
+	}
+
+	a := g.anomalies
+	for i := range a {
+		a[i].RetentionPolicy = rpOf[a[i].Shard]
+	}
+	sort.Slice(a, func(i, j int) bool {
+		x, y := &a[i], &a[j]
+		if x.Shard != y.Shard {
+			return x.Shard < y.Shard
+		}
+		if x.Series != y.Series {
+			return x.Series < y.Series
+		}
+		if x.Field != y.Field {
+			return x.Field < y.Field
+		}
+		return x.StartTime.Before(y.StartTime)
+	})
+
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dbPath, AnomaliesFileName), b, 0666)
+}
@@ -0,0 +1,107 @@
+package buildindex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influxdata/ingen"
+	"github.com/spf13/cobra"
+)
+
+type Command struct {
+	Concurrency     int
+	Database        string
+	RetentionPolicy string
+	WALPath         string
+	TSI             ingen.TSIConfig
+}
+
+func New() *cobra.Command {
+	var o Command
+	cmd := &cobra.Command{
+		Use:   "build-index <database path>",
+		Short: "Build the series file and TSI index of existing TSM shards",
+		Long: `Build the series file and a TSI index for each shard of the database from the
+series keys of its TSM files and WAL segments, replacing any existing TSI index.
+Shards written with the inmem index may then be opened by influxd using tsi1.`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.Run,
+	}
+
+	fs := cmd.Flags()
+	fs.IntVar(&o.Concurrency, "c", 1, "Concurrency")
+	fs.StringVar(&o.Database, "db", "", "Name of database (default is the base name of the database path)")
+	fs.StringVar(&o.RetentionPolicy, "rp", "", "Index only the shards of this retention policy")
+	fs.StringVar(&o.WALPath, "wal-path", "", "WAL directory of the database (default is that recorded in the manifest, or wal/<db> alongside the data path)")
+	fs.Uint64Var(&o.TSI.PartitionN, "tsi-partitions", 0, "Number of TSI index partitions, a power of 2; influxd requires TSI_PARTITIONS to match (default 8)")
+	fs.Int64Var(&o.TSI.MaxLogFileSize, "tsi-max-log-file-size", 0, "Size in bytes at which a TSI log file is compacted to an index file (default 5MB)")
+	fs.BoolVar(&o.TSI.SkipCompaction, "tsi-skip-compaction", false, "Leave TSI log files and level 1 index files rather than fully compacting the index")
+
+	return cmd
+}
+
+func (cmd *Command) Run(_ *cobra.Command, args []string) error {
+	dbPath := filepath.Clean(args[0])
+	if cmd.Database == "" {
+		cmd.Database = filepath.Base(dbPath)
+	}
+	if cmd.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be greater than 0")
+	}
+	if err := cmd.TSI.Validate(); err != nil {
+		return err
+	}
+
+	if cmd.WALPath == "" {
+		if m, err := ingen.ReadManifest(dbPath); err == nil && m.WALPath != "" {
+			cmd.WALPath = m.WALPath
+		} else {
+			cmd.WALPath = filepath.Join(filepath.Dir(filepath.Dir(dbPath)), "wal", filepath.Base(dbPath))
+		}
+	}
+
+	shards, err := ingen.FindShards(dbPath, cmd.WALPath)
+	if err != nil {
+		return err
+	}
+	if cmd.RetentionPolicy != "" {
+		var filtered []ingen.IndexShard
+		for _, sh := range shards {
+			if sh.RetentionPolicy == cmd.RetentionPolicy {
+				filtered = append(filtered, sh)
+			}
+		}
+		shards = filtered
+	}
+	if len(shards) == 0 {
+		return fmt.Errorf("no shards found in %s", dbPath)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 25, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Database\t%s\n", cmd.Database)
+	fmt.Fprintf(tw, "Database path\t%s\n", dbPath)
+	fmt.Fprintf(tw, "WAL path\t%s\n", cmd.WALPath)
+	fmt.Fprintf(tw, "Concurrency\t%d\n", cmd.Concurrency)
+	fmt.Fprintf(tw, "Shards\t%d\n", len(shards))
+	if cmd.TSI.PartitionN > 0 {
+		fmt.Fprintf(tw, "TSI partitions\t%d\n", cmd.TSI.PartitionN)
+	}
+	if cmd.TSI.MaxLogFileSize > 0 {
+		fmt.Fprintf(tw, "TSI max log file size\t%d\n", cmd.TSI.MaxLogFileSize)
+	}
+	fmt.Fprintf(tw, "TSI compaction\t%t\n", !cmd.TSI.SkipCompaction)
+	tw.Flush()
+
+	start := time.Now()
+	g := &ingen.Generator{Concurrency: cmd.Concurrency, TSI: cmd.TSI}
+	if err := g.BuildIndex(context.Background(), cmd.Database, dbPath, shards); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nTotal time: %0.1f seconds\n", time.Since(start).Seconds())
+	return nil
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/ingen"
 	"github.com/influxdata/ingen/pkg/gen"
 	"github.com/spf13/cobra"
@@ -19,16 +23,61 @@ import (
 type command struct {
 	PrintOnly               bool
 	BuildTSI                bool
+	TSI                     ingen.TSIConfig
 	Concurrency             int
+	Splits                  int
+	Encoders                int
+	MaxTSMFileSize          uint32
+	PointsPerBlock          int
+	MaxBlocksPerKey         int
+	Levels                  string
+	Overlap                 float64
+	WALLastShard            bool
+	Deletes                 []string
+	Duplicates              int
+	DuplicateFraction       float64
 	DataPath                string
 	MetaPath                string
+	WALPath                 string
 	StartTime               string
 	Database                string
 	RP                      string
 	ShardCount              int
+	ShardsPerGroup          int
 	ShardDuration           time.Duration
 	Tags                    string
 	PointsPerSeriesPerShard int
+	Values                  string
+	LifetimeFraction        float64
+	LifetimeMin             time.Duration
+	LifetimeMax             time.Duration
+	Anomalies               string
+	AnomalyMagnitude        float64
+	AnomalyDuration         time.Duration
+	Fields                  string
+	Preset                  string
+	S2Level                 int
+	Scale                   int
+	Seed                    int64
+	RPDuration              time.Duration
+	RPReplication           int
+	ExpiredShards           int
+	Expiring                bool
+	AllowFuture             bool
+	Precreate               int
+	Windows                 []string
+	Rollups                 []string
+	Density                 string
+	Churn                   float64
+	SpecPath                string
+	Spec                    *Spec // databases and retention policies read from SpecPath
+
+	tags      []int
+	levels    []int
+	deletes   []ingen.Delete
+	anomalies map[string]float64
+	fields    gen.FieldsModel
+	wtags     map[string]*gen.TagsListSequence // sorted tag sets of each measurement of the workload preset
 }
 
 func New() *cobra.Command {
@@ -42,27 +91,66 @@ func New() *cobra.Command {
 	fs := cmd.Flags()
 	fs.BoolVar(&o.PrintOnly, "print", false, "Print data spec only")
 	fs.BoolVar(&o.BuildTSI, "tsi", false, "Build TSI index")
+	fs.Uint64Var(&o.TSI.PartitionN, "tsi-partitions", 0, "Number of TSI index partitions, a power of 2; influxd requires TSI_PARTITIONS to match (default 8)")
+	fs.Int64Var(&o.TSI.MaxLogFileSize, "tsi-max-log-file-size", 0, "Size in bytes at which a TSI log file is compacted to an index file (default 5MB)")
+	fs.BoolVar(&o.TSI.SkipCompaction, "tsi-skip-compaction", false, "Leave TSI log files and level 1 index files rather than fully compacting the index")
 	fs.IntVar(&o.Concurrency, "c", 1, "Concurrency")
+	fs.IntVar(&o.Encoders, "encoders", 0, "Number of block encoders per shard writer (0 encodes inline)")
+	fs.IntVar(&o.Splits, "splits", 0, "Number of key ranges per shard written concurrently (default is concurrency / shards)")
 	fs.StringVar(&o.DataPath, "data-path", "", "path to InfluxDB data")
 	fs.StringVar(&o.MetaPath, "meta-path", "", "path to InfluxDB meta")
-	fs.StringVar(&o.StartTime, "start-time", "", "Start time")
+	fs.StringVar(&o.WALPath, "wal-path", "", "path to InfluxDB WAL (default is wal, alongside the data path)")
+	fs.StringVar(&o.StartTime, "start-time", "", "Start time, as RFC3339 or relative to now (e.g. now-30d or -7d)")
+	fs.BoolVar(&o.AllowFuture, "allow-future", false, "Allow shard groups, and their data, to extend past the current time")
+	fs.IntVar(&o.Precreate, "precreate", 0, "Number of empty shard groups to create following the last, as influxd's precreation service does")
 	fs.StringVar(&o.Database, "db", "db", "Name of database to create")
 	fs.StringVar(&o.RP, "rp", "rp", "Name of retention policy")
+	fs.DurationVar(&o.RPDuration, "rp-duration", 0, "Duration of retention policy (default infinite)")
+	fs.IntVar(&o.RPReplication, "rp-replication", 1, "Replication factor of retention policy")
+	fs.IntVar(&o.ExpiredShards, "expired-shards", 0, "Number of the oldest shard groups past the retention policy duration (requires --rp-duration)")
+	fs.BoolVar(&o.Expiring, "expiring", false, "Make the oldest shard group within the retention policy duration the next to expire (requires --rp-duration)")
+	fs.StringVar(&o.SpecPath, "spec", "", "TOML file declaring multiple databases and retention policies, which take the values of the shard options unless specified")
 	fs.IntVar(&o.ShardCount, "shards", 1, "Number of shards to create")
+	fs.IntVar(&o.ShardsPerGroup, "shards-per-group", 1, "Number of shards of each shard group, among which series are distributed by the hash of their key")
+	fs.StringArrayVar(&o.Windows, "window", nil, "Time range of contiguous shard groups, as start/end, in place of --start-time and --shards; may be repeated, leaving gaps between windows")
+	fs.StringArrayVar(&o.Rollups, "rollup", nil, "Window of a retention policy of rollups of the count, max, mean and min of each field, as window[:shard-duration] (e.g. 1h:7d); may be repeated")
+	fs.StringVar(&o.Density, "density", "", "Relative density of points of each shard group, as comma-separated factors repeated across shard groups, or ramp:<from>:<to>")
+	fs.Float64Var(&o.Churn, "churn", 0, "Fraction of series replaced by new series in each shard group, growing the series file whilst the series per shard are unchanged")
 	fs.DurationVar(&o.ShardDuration, "shard-duration", 24*time.Hour, "Shard duration (default 24h)")
 	fs.StringVar(&o.Tags, "t", "10,10,10", "Tag cardinality")
 	fs.IntVar(&o.PointsPerSeriesPerShard, "p", 100, "Points per series per shard")
+	fs.Uint32Var(&o.MaxTSMFileSize, "max-tsm-file-size", 2048*1024*1024, "Maximum size of a TSM file in bytes")
+	fs.IntVar(&o.PointsPerBlock, "points-per-block", tsdb.DefaultMaxPointsPerBlock, "Maximum number of points per block")
+	fs.IntVar(&o.MaxBlocksPerKey, "max-blocks-per-key", 0, "Maximum number of blocks per key in a TSM file (0 for no limit)")
+	fs.StringVar(&o.Levels, "levels", "", "Compaction level of each generation of TSM files in a shard, in time order, where 0 writes to the WAL (e.g. 4,3,2,1,0)")
+	fs.BoolVar(&o.WALLastShard, "wal-last-shard", false, "Write the most recent shard entirely to the WAL")
+	fs.IntVar(&o.Duplicates, "duplicates", 0, "Number of newer generations rewriting points of each shard with different values")
+	fs.Float64Var(&o.DuplicateFraction, "duplicate-fraction", 0.1, "Fraction of points rewritten by each duplicate generation")
+	fs.StringArrayVar(&o.Deletes, "delete", nil, "Series to delete once generated, as comma-separated measurement=, tag key=value, start= and end= (RFC3339) pairs; may be repeated")
+	fs.Float64Var(&o.Overlap, "overlap", 0, "Fraction of each generation's time range overlapping the next")
+	fs.StringVar(&o.Values, "values", "float-random", "Values sequence (float-random, float-constant or integer-constant)")
+	fs.Float64Var(&o.LifetimeFraction, "lifetime-fraction", 0, "Fraction of series which start and stop reporting within each shard group")
+	fs.DurationVar(&o.LifetimeMin, "lifetime-min", time.Hour, "Minimum lifetime of series which start and stop reporting within a shard group")
+	fs.DurationVar(&o.LifetimeMax, "lifetime-max", 6*time.Hour, "Maximum lifetime of series which start and stop reporting within a shard group")
+	fs.StringVar(&o.Anomalies, "anomalies", "", "Rate of each type of anomaly injected into series, as comma-separated type=rate pairs of spike, drop, level-shift, flatline and missing, written to "+ingen.AnomaliesFileName)
+	fs.Float64Var(&o.AnomalyMagnitude, "anomaly-magnitude", 100, "Amount by which spikes, drops and level shifts change values")
+	fs.DurationVar(&o.AnomalyDuration, "anomaly-duration", time.Hour, "Duration of level shifts, flatlines and missing values")
+	fs.StringVar(&o.Fields, "fields", "", "Related fields of each series in place of --values, as sum:<fields>[:<total>], derived:<fields>[:<scale>,<noise>] or counter:<fields>[:<factors>], where fields and factors are comma-separated")
+	fs.StringVar(&o.Preset, "preset", "", "Workload generated in place of --values or --fields, one of "+presetNames())
+	fs.IntVar(&o.Scale, "scale", 100, "Number of hosts, devices or nodes of the devops, iot, k8s and telegraf-system presets, in place of --t")
+	fs.IntVar(&o.S2Level, "s2-level", 11, "Level of the S2 cell IDs of the s2_cell_id tag of the geo preset")
+	fs.Int64Var(&o.Seed, "seed", 1, "Seed for random value sequences")
 
 	return cmd
 }
 
 func (cmd *command) Run(_ *cobra.Command, args []string) error {
-	db, gens, err := cmd.processOptions()
+	dbs, err := cmd.processOptions()
 	if err != nil {
 		return err
 	}
 
-	if db == nil {
+	if dbs == nil {
 		return nil
 	}
 
@@ -74,99 +162,499 @@ func (cmd *command) Run(_ *cobra.Command, args []string) error {
 		fmt.Printf("Total time: %0.1f seconds\n", elapsed.Seconds())
 	}()
 
-	groups := db.Info.RetentionPolicy(db.Info.DefaultRetentionPolicy).ShardGroups
+	// databases are generated concurrently, sharing a single limit
+	var (
+		lim  = ingen.NewLimiter(cmd.Concurrency)
+		sem  = make(chan struct{}, cmd.Concurrency)
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		seed = cmd.Seed
+	)
+
+	for _, db := range dbs {
+		var (
+			rps   = make([]ingen.RetentionPolicy, len(db.RPs))
+			seeds = make(map[*DBConfig]int64) // seed of the generators of each retention policy
+		)
+		for i, rp := range db.RPs {
+			groups := db.ShardGroups(rp)
+			var gens []ingen.SeriesGenerator
+			if raw := rp.Config.raw; raw != nil {
+				gens = cmd.newRollupGenerators(rp.Config, groups, db.ShardGroups(db.RP(raw.RP)), seeds[raw])
+			} else {
+				seeds[rp.Config] = seed
+				gens = cmd.newSeriesGenerators(rp.Config, groups, seed)
+				seed += int64(len(gens))
+			}
+			rps[i] = ingen.RetentionPolicy{
+				Name:      rp.Config.RP,
+				ShardPath: rp.ShardPath,
+				WALPath:   rp.WALPath,
+				Groups:    groups,
+				Gens:      gens,
+			}
+		}
+
+		wg.Add(1)
+		go func(db *Database, rps []ingen.RetentionPolicy) {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			g := ingen.Generator{
+				Concurrency:       cmd.Concurrency,
+				Limiter:           lim,
+				BuildTSI:          cmd.BuildTSI,
+				TSI:               cmd.TSI,
+				Splits:            cmd.Splits,
+				Encoders:          cmd.Encoders,
+				MaxTSMFileSize:    cmd.MaxTSMFileSize,
+				PointsPerBlock:    cmd.PointsPerBlock,
+				MaxBlocksPerKey:   cmd.MaxBlocksPerKey,
+				Levels:            cmd.levels,
+				Overlap:           cmd.Overlap,
+				WALLastShard:      cmd.WALLastShard,
+				Deletes:           cmd.deletes,
+				Duplicates:        cmd.Duplicates,
+				DuplicateFraction: cmd.DuplicateFraction,
+				Seed:              cmd.Seed,
+				Spec:              cmd,
+			}
+			if err := g.RunDatabase(context.Background(), db.Name(), db.Path, rps); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("error generating database %s: %v", db.Name(), err))
+				mu.Unlock()
+			}
+		}(db, rps)
+	}
+	wg.Wait()
 
-	g := ingen.Generator{Concurrency: cmd.Concurrency, BuildTSI: cmd.BuildTSI}
-	return g.Run(context.Background(), db.database, db.ShardPath, groups, gens)
+	return ingen.NewErrorList(errs)
 }
 
-func (cmd *command) processOptions() (db *Database, gens []ingen.SeriesGenerator, err error) {
-	cfg := new(DBConfig)
+func (cmd *command) processOptions() (dbs []*Database, err error) {
+	if cmd.levels, err = parseLevels(cmd.Levels); err != nil {
+		return nil, err
+	}
+	if cmd.Overlap < 0 || cmd.Overlap > 1 {
+		return nil, fmt.Errorf("overlap must be between 0 and 1")
+	}
+	if err = cmd.TSI.Validate(); err != nil {
+		return nil, err
+	}
+	if cmd.DuplicateFraction < 0 || cmd.DuplicateFraction > 1 {
+		return nil, fmt.Errorf("duplicate fraction must be between 0 and 1")
+	}
+	if n := len(cmd.levels); cmd.Duplicates > 0 && (cmd.WALLastShard || n > 0 && cmd.levels[n-1] == 0) {
+		return nil, fmt.Errorf("duplicates cannot be combined with a WAL level or WAL last shard, as the WAL takes precedence over them")
+	}
+	for _, d := range cmd.Deletes {
+		del, err := parseDelete(d)
+		if err != nil {
+			return nil, err
+		}
+		cmd.deletes = append(cmd.deletes, del)
+	}
+
+	base := new(DBConfig)
 
-	cfg.Database = cmd.Database
-	cfg.RP = cmd.RP
-	cfg.DataPath = cmd.DataPath
-	cfg.MetaPath = cmd.MetaPath
-	cfg.ShardDuration.Duration = cmd.ShardDuration
-	cfg.ShardCount = cmd.ShardCount
+	base.Database = cmd.Database
+	base.RP = cmd.RP
+	base.DataPath = cmd.DataPath
+	base.MetaPath = cmd.MetaPath
+	base.WALPath = cmd.WALPath
+	base.Duration.Duration = cmd.RPDuration
+	base.Replication = cmd.RPReplication
+	base.ExpiredShards = cmd.ExpiredShards
+	base.Expiring = cmd.Expiring
+	base.ShardDuration.Duration = cmd.ShardDuration
+	base.ShardCount = cmd.ShardCount
+	base.ShardsPerGroup = cmd.ShardsPerGroup
+
+	base.AllowFuture = cmd.AllowFuture
+	base.Precreate = cmd.Precreate
+	base.Density = cmd.Density
+	base.Churn = cmd.Churn
+	for _, w := range cmd.Windows {
+		win, err := parseWindow(w, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		base.Windows = append(base.Windows, win)
+	}
+	for _, r := range cmd.Rollups {
+		rollup, err := parseRollup(r)
+		if err != nil {
+			return nil, err
+		}
+		base.Rollups = append(base.Rollups, rollup)
+	}
 
 	if cmd.StartTime != "" {
-		if t, err := time.Parse(time.RFC3339, cmd.StartTime); err != nil {
-			return nil, nil, err
+		if t, err := parseTime(cmd.StartTime, time.Now()); err != nil {
+			return nil, err
 		} else {
-			cfg.StartTime = t.UTC()
+			base.StartTime = t
 		}
 	}
 
-	if err = cfg.Validate(); err != nil {
-		return nil, nil, err
+	cfgs := [][]*DBConfig{{base}}
+	if cmd.SpecPath != "" {
+		if cmd.Spec, err = ReadSpec(cmd.SpecPath); err != nil {
+			return nil, err
+		}
+		if cfgs, err = cmd.Spec.configs(base); err != nil {
+			return nil, err
+		}
 	}
 
-	// Parse tag cardinalities.
 	var (
-		tags  []int
-		tagsN int
+		rpN     int
+		shardN  int
+		pointsN int // points per series across all shards
 	)
+	for i, db := range cfgs {
+		names := make(map[string]bool)
+		for _, cfg := range db {
+			names[cfg.RP] = true
+		}
+
+		// the retention policies of rollups follow those of the database
+		var rollups []*DBConfig
+		for _, cfg := range db {
+			if err = cfg.Validate(); err != nil {
+				return nil, err
+			}
+			if _, ok := presets[cmd.Preset]; ok && cfg.Churn > 0 {
+				return nil, fmt.Errorf("preset %s does not support churn", cmd.Preset)
+			}
+			rpN++
+			shardN += cfg.ShardCount * cfg.ShardsPerGroup
+			for _, p := range pointsPerShard(cfg, cmd.PointsPerSeriesPerShard) {
+				pointsN += p
+			}
+
+			rcs, err := cfg.rollupConfigs()
+			if err != nil {
+				return nil, err
+			}
+			if len(rcs) > 0 && (cmd.Duplicates > 0 || len(cmd.deletes) > 0) {
+				// rollups are computed from the generated points, not those left once the
+				// duplicates and deletes are applied
+				return nil, fmt.Errorf("%s/%s: rollups cannot be combined with duplicates or deletes", cfg.Database, cfg.RP)
+			}
+			for _, rc := range rcs {
+				if names[rc.RP] {
+					return nil, fmt.Errorf("%s/%s: duplicate retention policy", rc.Database, rc.RP)
+				}
+				names[rc.RP] = true
+				if err = rc.Validate(); err != nil {
+					return nil, err
+				}
+				rpN++
+				shardN += rc.ShardCount
+			}
+			rollups = append(rollups, rcs...)
+		}
+		cfgs[i] = append(db, rollups...)
+	}
+
+	if cmd.Splits == 0 {
+		cmd.Splits = (cmd.Concurrency + shardN - 1) / shardN
+	}
+
+	if cmd.PointsPerBlock < 1 {
+		return nil, fmt.Errorf("points per block must be ≥ 1")
+	}
+
+	switch cmd.Values {
+	case "float-random", "float-constant", "integer-constant":
+	default:
+		return nil, fmt.Errorf("invalid values sequence: %s", cmd.Values)
+	}
+
+	if cmd.fields, err = parseFields(cmd.Fields); err != nil {
+		return nil, err
+	}
+	if cmd.Preset != "" {
+		p, ok := presets[cmd.Preset]
+		if !ok {
+			return nil, fmt.Errorf("invalid preset %q: must be one of %s", cmd.Preset, presetNames())
+		}
+		if cmd.fields != nil {
+			return nil, fmt.Errorf("preset %s cannot be combined with fields", cmd.Preset)
+		}
+		if p.Fixed && (cmd.LifetimeFraction > 0 || cmd.Anomalies != "") {
+			return nil, fmt.Errorf("preset %s does not support lifetimes or anomalies", cmd.Preset)
+		}
+		if p.Workload != nil && cmd.Scale < 1 {
+			return nil, fmt.Errorf("scale must be ≥ 1")
+		}
+	}
+	if cmd.S2Level < 0 || cmd.S2Level > gen.MaxS2Level {
+		return nil, fmt.Errorf("S2 level must be between 0 and %d", gen.MaxS2Level)
+	}
+
+	if cmd.LifetimeFraction < 0 || cmd.LifetimeFraction > 1 {
+		return nil, fmt.Errorf("lifetime fraction must be between 0 and 1")
+	}
+	if cmd.LifetimeMin <= 0 || cmd.LifetimeMax < cmd.LifetimeMin {
+		return nil, fmt.Errorf("lifetimes must be > 0, with the maximum ≥ the minimum")
+	}
+	if cmd.anomalies, err = parseAnomalies(cmd.Anomalies); err != nil {
+		return nil, err
+	}
+	if cmd.AnomalyDuration <= 0 {
+		return nil, fmt.Errorf("anomaly duration must be > 0")
+	}
+
+	// Parse tag cardinalities.
+	var tagsN int
 	tagsN = 1
 	for _, s := range strings.Split(cmd.Tags, ",") {
 		v, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, nil, fmt.Errorf("cannot parse tag cardinality: %s", s)
+			return nil, fmt.Errorf("cannot parse tag cardinality: %s", s)
 		}
-		tags = append(tags, v)
+		cmd.tags = append(cmd.tags, v)
 		tagsN *= v
 	}
+	if p, ok := presets[cmd.Preset]; ok {
+		if p.Workload != nil {
+			tagsN = cmd.workloadSeriesN(p.Workload)
+		} else {
+			tagsN *= p.SeriesN
+		}
+	}
+
+	cfg := cfgs[0][0]
 
 	mp := message.NewPrinter(message.MatchLanguage("en"))
 	tw := tabwriter.NewWriter(os.Stdout, 25, 4, 2, ' ', 0)
 	mp.Fprintf(tw, "Data Path\t%s\n", cfg.DataPath)
 	mp.Fprintf(tw, "Meta Path\t%s\n", cfg.MetaPath)
+	mp.Fprintf(tw, "WAL Path\t%s\n", cfg.WALPath)
 	mp.Fprintf(tw, "Concurrency\t%d\n", cmd.Concurrency)
-	mp.Fprintf(tw, "Tag cardinalities\t%s\n", fmt.Sprintf("%+v", tags))
+	mp.Fprintf(tw, "Key ranges per shard\t%d\n", cmd.Splits)
+	mp.Fprintf(tw, "Block encoders\t%d\n", cmd.Encoders)
+	mp.Fprintf(tw, "Tag cardinalities\t%s\n", fmt.Sprintf("%+v", cmd.tags))
 	mp.Fprintf(tw, "Points per series per shard\t%d\n", cmd.PointsPerSeriesPerShard)
-	mp.Fprintf(tw, "Total points per shard\t%d\n", tagsN*cmd.PointsPerSeriesPerShard)
-	mp.Fprintf(tw, "Total series\t%d\n", tagsN)
-	mp.Fprintf(tw, "Total points\t%d\n", tagsN*cfg.ShardCount*cmd.PointsPerSeriesPerShard)
-	mp.Fprintf(tw, "Shard Count\t%d\n", cfg.ShardCount)
-	mp.Fprintf(tw, "Database\t%s/%s (Shard duration: %s)\n", cfg.Database, cfg.RP, cfg.ShardDuration)
+	if tagsN > 0 {
+		// the series of some presets depend on the generated values
+		mp.Fprintf(tw, "Total points per shard\t%d\n", tagsN*cmd.PointsPerSeriesPerShard)
+		mp.Fprintf(tw, "Total series\t%d\n", totalSeries(cfgs, tagsN))
+		mp.Fprintf(tw, "Total points\t%d\n", tagsN*pointsN)
+	}
+	if rpN == 1 {
+		mp.Fprintf(tw, "Shard Count\t%d\n", cfg.ShardCount)
+		if cfg.ShardsPerGroup > 1 {
+			mp.Fprintf(tw, "Shards per group\t%d\n", cfg.ShardsPerGroup)
+		}
+		mp.Fprintf(tw, "Database\t%s/%s (Shard duration: %s)\n", cfg.Database, cfg.RP, cfg.ShardDuration)
+	} else {
+		mp.Fprintf(tw, "Databases\t%d\n", len(cfgs))
+		mp.Fprintf(tw, "Retention policies\t%d\n", rpN)
+		mp.Fprintf(tw, "Shard Count\t%d\n", shardN)
+	}
+	for _, db := range cfgs {
+		for _, cfg := range db {
+			if cfg.Duration.Duration > 0 || cfg.Replication > 1 {
+				mp.Fprintf(tw, "Retention policy\t%s/%s (Duration: %s, Replication: %d, Expired shards: %d)\n",
+					cfg.Database, cfg.RP, cfg.Duration, cfg.Replication, cfg.ExpiredShards)
+			}
+			if rpN > 1 {
+				mp.Fprintf(tw, "Shard groups\t%s/%s: %d × %s, %s to %s\n", cfg.Database, cfg.RP, cfg.ShardCount, cfg.ShardDuration, cfg.StartTime, cfg.EndTime())
+				if cfg.ShardsPerGroup > 1 {
+					mp.Fprintf(tw, "Shards per group\t%s/%s: %d\n", cfg.Database, cfg.RP, cfg.ShardsPerGroup)
+				}
+			}
+			for _, w := range cfg.Windows {
+				if cfg.raw != nil {
+					break // the windows of rollups are those of the retention policy rolled up
+				}
+				mp.Fprintf(tw, "Window\t%s/%s: %s\n", cfg.Database, cfg.RP, w)
+			}
+			if cfg.Density != "" {
+				mp.Fprintf(tw, "Density\t%s/%s: %s\n", cfg.Database, cfg.RP, cfg.Density)
+			}
+			if cfg.Churn > 0 {
+				mp.Fprintf(tw, "Churn\t%s/%s: %0.2f\n", cfg.Database, cfg.RP, cfg.Churn)
+			}
+			if cfg.raw != nil {
+				mp.Fprintf(tw, "Rollup\t%s/%s: count, max, mean and min of %s over %s\n", cfg.Database, cfg.RP, cfg.raw.RP, cfg.rollup.Window)
+			}
+		}
+	}
 	mp.Fprintf(tw, "TSI\t%t\n", cmd.BuildTSI)
-	mp.Fprintf(tw, "Start time\t%s\n", cfg.StartTime)
-	mp.Fprintf(tw, "End time\t%s\n", cfg.EndTime())
+	if cmd.BuildTSI {
+		if cmd.TSI.PartitionN > 0 {
+			mp.Fprintf(tw, "TSI partitions\t%d\n", cmd.TSI.PartitionN)
+		}
+		if cmd.TSI.MaxLogFileSize > 0 {
+			mp.Fprintf(tw, "TSI max log file size\t%d\n", cmd.TSI.MaxLogFileSize)
+		}
+		mp.Fprintf(tw, "TSI compaction\t%t\n", !cmd.TSI.SkipCompaction)
+	}
+	mp.Fprintf(tw, "Points per block\t%d\n", cmd.PointsPerBlock)
+	mp.Fprintf(tw, "Max TSM file size\t%d\n", cmd.MaxTSMFileSize)
+	if len(cmd.levels) > 0 {
+		mp.Fprintf(tw, "TSM levels\t%s (overlap: %0.2f)\n", fmt.Sprintf("%+v", cmd.levels), cmd.Overlap)
+	}
+	if cmd.Precreate > 0 {
+		mp.Fprintf(tw, "Precreated shard groups\t%d\n", cmd.Precreate)
+	}
+	if cmd.WALLastShard {
+		mp.Fprintf(tw, "WAL\tmost recent shard\n")
+	}
+	if cmd.Duplicates > 0 {
+		mp.Fprintf(tw, "Duplicate generations\t%d (fraction: %0.2f)\n", cmd.Duplicates, cmd.DuplicateFraction)
+	}
+	for _, d := range cmd.Deletes {
+		mp.Fprintf(tw, "Delete\t%s\n", d)
+	}
+	if cmd.Preset != "" {
+		mp.Fprintf(tw, "Preset\t%s\n", cmd.Preset)
+		if presets[cmd.Preset].Workload != nil {
+			mp.Fprintf(tw, "Scale\t%d\n", cmd.Scale)
+		}
+	} else if cmd.fields != nil {
+		mp.Fprintf(tw, "Fields\t%s\n", cmd.Fields)
+	} else {
+		mp.Fprintf(tw, "Values\t%s\n", cmd.Values)
+	}
+	if cmd.LifetimeFraction > 0 {
+		mp.Fprintf(tw, "Series lifetimes\t%0.2f of series, %s to %s\n", cmd.LifetimeFraction, cmd.LifetimeMin, cmd.LifetimeMax)
+	}
+	if cmd.Anomalies != "" {
+		mp.Fprintf(tw, "Anomalies\t%s (magnitude: %v, duration: %s)\n", cmd.Anomalies, cmd.AnomalyMagnitude, cmd.AnomalyDuration)
+	}
+	mp.Fprintf(tw, "Seed\t%d\n", cmd.Seed)
+	if rpN == 1 {
+		mp.Fprintf(tw, "Start time\t%s\n", cfg.StartTime)
+		mp.Fprintf(tw, "End time\t%s\n", cfg.EndTime())
+	}
 	tw.Flush()
 
 	if cmd.PrintOnly {
-		return nil, nil, nil
+		return nil, nil
 	}
 
-	db = NewDatabase(cfg)
-	if err = db.Create(); err != nil {
-		return nil, nil, err
+	client := meta.NewClient(&meta.Config{Dir: cfg.MetaPath})
+	if err = client.Open(); err != nil {
+		return nil, err
 	}
+	defer client.Close()
 
-	groups := db.Info.RetentionPolicy(db.Info.DefaultRetentionPolicy).ShardGroups
-	gens = make([]ingen.SeriesGenerator, len(groups))
-	for i := range gens {
-		var (
-			name []byte
-			keys []string
-			tv   []gen.Sequence
-		)
+	for _, db := range cfgs {
+		d := NewDatabase(db...)
+		if err = d.Create(client); err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, d)
+	}
+
+	return dbs, nil
+}
+
+// newSeriesGenerators returns the series generator of each shard of each shard group of
+// the retention policy cfg, scaling the points per series by the density of the shard group.
+// The random values sequence of each shard is seeded from seed, incrementally.
+func (cmd *command) newSeriesGenerators(cfg *DBConfig, groups []meta.ShardGroupInfo, seed int64) []ingen.SeriesGenerator {
+	points := pointsPerShard(cfg, cmd.PointsPerSeriesPerShard)
+	var gens []ingen.SeriesGenerator
+	for i := range groups {
+		for range groups[i].Shards {
+			gens = append(gens, cmd.newSeriesGenerator(cfg, &groups[i], i, points[i], seed+int64(len(gens))))
+		}
+	}
+	return gens
+}
+
+// newSeriesGenerator returns a series generator of points per series over the shard group sgi,
+// the shard group with index i of the retention policy cfg.
+func (cmd *command) newSeriesGenerator(cfg *DBConfig, sgi *meta.ShardGroupInfo, i, points int, seed int64) ingen.SeriesGenerator {
+	var (
+		name []byte
+		keys []string
+		tv   []gen.Sequence
+	)
+
+	name = []byte("m0")
+	tv = make([]gen.Sequence, len(cmd.tags))
+	setTagVals(cmd.tags, tv)
+	keys = make([]string, len(cmd.tags))
+	setTagKeys("tag", keys)
 
-		name = []byte("m0")
-		tv = make([]gen.Sequence, len(tags))
-		setTagVals(tags, tv)
-		keys = make([]string, len(tags))
-		setTagKeys("tag", keys)
+	delta := cfg.ShardDuration.Duration / time.Duration(points)
 
-		sgi := &groups[i]
-		//vg := gen.NewIntegerConstantValuesSequence(cmd.PointsPerSeriesPerShard, sgi.StartTime, cfg.ShardDuration.Duration/time.Duration(cmd.PointsPerSeriesPerShard), 1)
-		vg := gen.NewFloatRandomValuesSequence(cmd.PointsPerSeriesPerShard, sgi.StartTime, cfg.ShardDuration.Duration/time.Duration(cmd.PointsPerSeriesPerShard), 10)
+	if p, ok := presets[cmd.Preset]; ok {
+		return p.Series(cmd, keys, tv, sgi, points, delta, seed)
+	}
+
+	var tags gen.TagsSequence = gen.NewTagsValuesSequenceKeysValues(keys, tv)
+	if cfg.Churn > 0 {
+		tags = gen.NewChurnTagsSequence(tags, cfg.replacedSeries(i, tags.Count()))
+	}
+
+	if cmd.fields != nil {
+		// the sequences of the fields share the values of each point, so that they are related
+		fields := cmd.fields.Fields()
+		vgs := make([]ingen.ValuesSequence, len(fields))
+		for j, vg := range gen.NewFieldValuesSequences(cmd.fields.Clone(), points, sgi.StartTime, delta, rand.New(rand.NewSource(seed))) {
+			vgs[j] = cmd.decorateValues(vg, sgi, seed)
+		}
+		return gen.NewFieldsSeriesGenerator(name, fields, vgs, tags)
+	}
+
+	var vg ingen.ValuesSequence
+	switch cmd.Values {
+	case "float-constant":
+		vg = gen.NewFloatConstantValuesSequence(points, sgi.StartTime, delta, 1)
+	case "integer-constant":
+		vg = gen.NewIntegerConstantValuesSequence(points, sgi.StartTime, delta, 1)
+	default:
+		vg = gen.NewFloatRandomValuesSequence(points, sgi.StartTime, delta, 10, rand.New(rand.NewSource(seed)))
+	}
+
+	return gen.NewSeriesGenerator(name, "v0", cmd.decorateValues(vg, sgi, seed), tags)
+}
 
-		gens[i] = gen.NewSeriesGenerator(name, "v0", vg, gen.NewTagsValuesSequenceKeysValues(keys, tv))
+// decorateValues limits the values of vg to the lifetime of each series and injects anomalies,
+// if specified, drawing from sources seeded from seed.
+func (cmd *command) decorateValues(vg ingen.ValuesSequence, sgi *meta.ShardGroupInfo, seed int64) ingen.ValuesSequence {
+	if cmd.LifetimeFraction > 0 {
+		// lifetimes are drawn from a source independent of the random values
+		r := rand.New(rand.NewSource(^seed))
+		vg = gen.NewLifetimeValuesSequence(vg, sgi.StartTime, sgi.EndTime, cmd.LifetimeFraction, cmd.LifetimeMin, cmd.LifetimeMax, r)
 	}
 
-	return db, gens, nil
+	if len(cmd.anomalies) > 0 {
+		// anomalies are injected into the values of the lifetime of each series, drawn
+		// from a source independent of both
+		r := rand.New(rand.NewSource(seed + 1<<32))
+		cfg := gen.AnomalyConfig{Rates: cmd.anomalies, Magnitude: cmd.AnomalyMagnitude, Duration: cmd.AnomalyDuration}
+		vg = gen.NewAnomalyValuesSequence(vg, sgi.StartTime, sgi.EndTime, cfg, r)
+	}
+	return vg
+}
 
+// totalSeries returns the number of series of the databases cfgs, of n series per shard group,
+// including the series replaced by churn. The retention policies of a database share its series.
+func totalSeries(cfgs [][]*DBConfig, n int) int {
+	total := 0
+	for _, db := range cfgs {
+		replaced := 0
+		for _, cfg := range db {
+			if r := cfg.replacedSeries(cfg.ShardCount-1, n); r > replaced {
+				replaced = r
+			}
+		}
+		total += n + replaced
+	}
+	return total
 }
 
 func setTagVals(tags []int, tv []gen.Sequence) {
@@ -182,3 +670,154 @@ func setTagKeys(prefix string, keys []string) {
 		keys[i] = fmt.Sprintf(tf, i)
 	}
 }
+
+// parseLevels parses a comma-separated list of TSM compaction levels, where only
+// the last, most recent generation may be written to the WAL.
+func parseLevels(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	vals := strings.Split(s, ",")
+	levels := make([]int, 0, len(vals))
+	for i, v := range vals {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 || l > 4 {
+			return nil, fmt.Errorf("invalid TSM level %q: must be 0 (WAL) to 4", v)
+		}
+		if l == 0 && i < len(vals)-1 {
+			return nil, fmt.Errorf("invalid TSM levels %q: only the last generation may be 0 (WAL)", s)
+		}
+		levels = append(levels, l)
+	}
+	return levels, nil
+}
+
+// parseFields parses the model of related fields of each series, of the form
+// <model>:<fields>[:<params>], where fields and params are comma-separated.
+func parseFields(s string) (gen.FieldsModel, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid fields %q: expected <model>:<fields>[:<params>]", s)
+	}
+
+	fields := strings.Split(parts[1], ",")
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if f == "" || seen[f] {
+			return nil, fmt.Errorf("invalid fields %q: field names must be unique and not empty", s)
+		}
+		seen[f] = true
+	}
+
+	var params []float64
+	if len(parts) == 3 {
+		for _, p := range strings.Split(parts[2], ",") {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fields %q: %s", s, err.Error())
+			}
+			params = append(params, v)
+		}
+	}
+
+	switch parts[0] {
+	case "sum":
+		total := 100.0
+		if len(params) > 1 {
+			return nil, fmt.Errorf("invalid fields %q: expected a single total", s)
+		} else if len(params) == 1 {
+			total = params[0]
+		}
+		return gen.NewSumFieldsModel(fields, total), nil
+
+	case "derived":
+		scale, noise := 1.0, 1.0
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid fields %q: expected a field and one or more fields derived from it", s)
+		}
+		if len(params) == 2 {
+			scale, noise = params[0], params[1]
+		} else if len(params) != 0 {
+			return nil, fmt.Errorf("invalid fields %q: expected scale and noise", s)
+		}
+		return gen.NewDerivedFieldsModel(fields, scale, noise), nil
+
+	case "counter":
+		factors := make([]int64, len(fields))
+		for i := range factors {
+			factors[i] = 1
+		}
+		if len(params) > 0 {
+			if len(params) != len(fields) {
+				return nil, fmt.Errorf("invalid fields %q: expected a factor for each field", s)
+			}
+			for i, p := range params {
+				if p < 1 || p != math.Trunc(p) {
+					return nil, fmt.Errorf("invalid fields %q: factors must be integers ≥ 1", s)
+				}
+				factors[i] = int64(p)
+			}
+		}
+		return gen.NewCounterFieldsModel(fields, factors), nil
+	}
+	return nil, fmt.Errorf("invalid fields %q: model must be sum, derived or counter", s)
+}
+
+// parseAnomalies parses comma-separated type=rate pairs of the anomalies injected into series.
+func parseAnomalies(s string) (map[string]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !gen.IsAnomalyType(kv[0]) {
+			return nil, fmt.Errorf("invalid anomaly %q: expected type=rate, where type is spike, drop, level-shift, flatline or missing", pair)
+		}
+		rate, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid anomaly %q: rate must be between 0 and 1", pair)
+		}
+		rates[kv[0]] = rate
+	}
+	return rates, nil
+}
+
+// parseDelete parses a delete of the form measurement=m0,tag0=value0,start=<RFC3339>,end=<RFC3339>,
+// where each pair is optional.
+func parseDelete(s string) (d ingen.Delete, err error) {
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return d, fmt.Errorf("invalid delete %q: expected key=value, got %q", s, pair)
+		}
+
+		k, v := kv[0], kv[1]
+		switch k {
+		case "measurement":
+			d.Measurement = v
+		case "start", "end":
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return d, fmt.Errorf("invalid delete %q: %s", s, err.Error())
+			}
+			if k == "start" {
+				d.Start = t.UTC()
+			} else {
+				d.End = t.UTC()
+			}
+		default:
+			if d.Tags == nil {
+				d.Tags = make(map[string]string)
+			}
+			d.Tags[k] = v
+		}
+	}
+	return d, nil
+}
@@ -2,23 +2,43 @@ package genshards
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
 	"github.com/influxdata/ingen"
 )
 
+// DBConfig describes a retention policy of a database and its shard groups.
 type DBConfig struct {
-	DataPath      string `toml:"data-path"`
-	MetaPath      string `toml:"meta-path"`
-	Database      string
-	RP            string
-	StartTime     time.Time `toml:"start-time"`
-	ShardCount    int       `toml:"shard-count"`
-	ShardDuration duration  `toml:"shard-duration"`
+	DataPath       string `toml:"data-path"`
+	MetaPath       string `toml:"meta-path"`
+	WALPath        string `toml:"wal-path"`
+	Database       string
+	RP             string
+	Default        bool      // retention policy is the default of the database
+	Duration       duration  // duration of the retention policy; if zero, infinite
+	Replication    int       // replication factor of the retention policy; if zero, 1
+	ExpiredShards  int       `toml:"expired-shards"` // number of shard groups past the retention policy's duration
+	Expiring       bool      // the oldest shard group within the retention policy's duration is the next to expire
+	AllowFuture    bool      `toml:"allow-future"` // permit shard groups, and their data, ending after the current time
+	Precreate      int       // number of empty shard groups created following the last, as by influxd's precreation service
+	StartTime      time.Time `toml:"start-time"`
+	ShardCount     int       `toml:"shard-count"`
+	ShardDuration  duration  `toml:"shard-duration"`
+	ShardsPerGroup int       `toml:"shards-per-group"` // number of shards of each shard group; if zero, 1
+	Windows        []Window  // if not empty, time ranges of the shard groups, which determine StartTime and ShardCount
+	Density        string    // relative density of points of each shard group, per parseDensity
+	Churn          float64   // fraction of series replaced by new series in each shard group
+	Rollups        []Rollup  // retention policies holding rollups of the series of the retention policy
+
+	raw    *DBConfig // if not nil, the retention policy of which this holds the rollup
+	rollup *Rollup
 }
 
 func (cfg *DBConfig) Validate() error {
@@ -38,81 +58,242 @@ func (cfg *DBConfig) TimeSpan() time.Duration {
 }
 
 func (cfg *DBConfig) EndTime() time.Time {
+	if len(cfg.Windows) > 0 {
+		starts := cfg.shardGroupStarts()
+		return starts[len(starts)-1].Add(cfg.ShardDuration.Duration)
+	}
 	return cfg.StartTime.Add(cfg.TimeSpan())
 }
 
-type Database struct {
-	Info      *meta.DatabaseInfo
-	ShardPath string
+// shardGroupStarts returns the start time of each shard group, in time order.
+func (cfg *DBConfig) shardGroupStarts() []time.Time {
+	sd := cfg.ShardDuration.Duration
 
-	dataPath      string
-	metaPath      string
-	database      string
-	rp            string
-	startTime     time.Time
-	shardCount    int
-	shardDuration time.Duration
+	var starts []time.Time
+	if len(cfg.Windows) == 0 {
+		ts := cfg.StartTime.Truncate(sd).UTC()
+		for i := 0; i < cfg.ShardCount; i++ {
+			starts = append(starts, ts)
+			ts = ts.Add(sd)
+		}
+		return starts
+	}
+
+	for _, w := range cfg.Windows {
+		for ts := w.Start.Truncate(sd).UTC(); ts.Before(w.End); ts = ts.Add(sd) {
+			if n := len(starts); n == 0 || ts.After(starts[n-1]) {
+				starts = append(starts, ts)
+			}
+		}
+	}
+	return starts
+}
+
+// retentionBoundary returns the latest shard group boundary at which shard groups
+// ending at or before it are past the retention policy's duration at now.
+func (cfg *DBConfig) retentionBoundary(now time.Time) time.Time {
+	return now.Add(-cfg.Duration.Duration).Truncate(cfg.ShardDuration.Duration)
 }
 
-func NewDatabase(cfg *DBConfig) *Database {
-	return &Database{
-		dataPath:      cfg.DataPath,
-		metaPath:      cfg.MetaPath,
-		database:      cfg.Database,
-		rp:            cfg.RP,
-		startTime:     cfg.StartTime,
-		shardCount:    cfg.ShardCount,
-		shardDuration: cfg.ShardDuration.Duration,
+// replacedSeries returns the number of series, of the n series of each shard group,
+// replaced by new series by the start of the shard group with index i.
+func (cfg *DBConfig) replacedSeries(i, n int) int {
+	return int(math.Round(float64(i) * cfg.Churn * float64(n)))
+}
+
+// expiredShards returns the number of shard groups past the retention policy's duration at now.
+func (cfg *DBConfig) expiredShards(now time.Time) int {
+	if cfg.Duration.Duration == 0 {
+		return 0
+	}
+
+	b := cfg.retentionBoundary(now)
+	n := 0
+	for _, ts := range cfg.shardGroupStarts() {
+		if !ts.Add(cfg.ShardDuration.Duration).After(b) {
+			n++
+		}
 	}
+	return n
 }
 
-func (db *Database) Create() (err error) {
-	client := meta.NewClient(&meta.Config{Dir: db.metaPath})
-	if err = client.Open(); err != nil {
-		return err
+// RetentionPolicy is a retention policy created by Database.Create.
+type RetentionPolicy struct {
+	Config    *DBConfig
+	ShardPath string
+	WALPath   string
+}
+
+func (rp *RetentionPolicy) spec() *meta.RetentionPolicySpec {
+	spec := &meta.RetentionPolicySpec{
+		Name:               rp.Config.RP,
+		ShardGroupDuration: rp.Config.ShardDuration.Duration,
+	}
+	if d := rp.Config.Duration.Duration; d > 0 {
+		spec.Duration = &d
 	}
-	defer client.Close()
+	if n := rp.Config.Replication; n > 0 {
+		spec.ReplicaN = &n
+	}
+	return spec
+}
+
+// Database is a database with one or more retention policies.
+type Database struct {
+	Info *meta.DatabaseInfo
+	Path string
+	RPs  []*RetentionPolicy
+
+	name     string
+	dataPath string
+	walPath  string
+}
 
+// NewDatabase returns a Database with a retention policy for each of cfgs,
+// which must specify the same database and paths.
+func NewDatabase(cfgs ...*DBConfig) *Database {
+	db := &Database{
+		name:     cfgs[0].Database,
+		dataPath: cfgs[0].DataPath,
+		walPath:  cfgs[0].WALPath,
+	}
+	for _, cfg := range cfgs {
+		db.RPs = append(db.RPs, &RetentionPolicy{Config: cfg})
+	}
+	return db
+}
+
+// Name returns the name of the database.
+func (db *Database) Name() string { return db.name }
+
+// Create drops and recreates the database, its retention policies and their shard groups.
+// The first retention policy is the default, unless another specifies Default.
+func (db *Database) Create(client *meta.Client) (err error) {
 	// drop and recreate database
-	client.DropDatabase(db.database)
-	dbpath := filepath.Join(db.dataPath, db.database)
-	if err = os.RemoveAll(dbpath); err != nil {
+	client.DropDatabase(db.name)
+	db.Path = filepath.Join(db.dataPath, db.name)
+	if err = os.RemoveAll(db.Path); err != nil {
+		return err
+	}
+	walpath := filepath.Join(db.walPath, db.name)
+	if err = os.RemoveAll(walpath); err != nil {
 		return err
 	}
 
-	var rp meta.RetentionPolicySpec
-	rp.ShardGroupDuration = db.shardDuration
-	rp.Name = db.rp
-	db.Info, err = client.CreateDatabaseWithRetentionPolicy(db.database, &rp)
-	if err != nil {
+	def := db.RPs[0]
+	for _, rp := range db.RPs {
+		if rp.Config.Default {
+			def = rp
+		}
+	}
+
+	if db.Info, err = client.CreateDatabaseWithRetentionPolicy(db.name, def.spec()); err != nil {
 		return err
 	}
+	for _, rp := range db.RPs {
+		if rp == def {
+			continue
+		}
+		if _, err = client.CreateRetentionPolicy(db.name, rp.spec(), false); err != nil {
+			return fmt.Errorf("error creating retention policy %s.%s: %s", db.name, rp.Config.RP, err.Error())
+		}
+	}
+
+	for _, rp := range db.RPs {
+		rp.ShardPath = filepath.Join(db.Path, rp.Config.RP)
+		rp.WALPath = filepath.Join(walpath, rp.Config.RP)
+		if err = db.createShardGroups(client, rp); err != nil {
+			return err
+		}
+	}
+
+	db.Info = client.Database(db.name)
 
-	db.ShardPath = filepath.Join(dbpath, db.Info.DefaultRetentionPolicy)
-	return db.createShardGroups(client)
+	return nil
 }
 
-func (db *Database) createShardGroups(client *meta.Client) error {
-	ts := db.startTime.Truncate(db.shardDuration).UTC()
+func (db *Database) createShardGroups(client *meta.Client, rp *RetentionPolicy) error {
+	cfg := rp.Config
 
-	var err error
-	groups := make([]*meta.ShardGroupInfo, db.shardCount)
-	for i := 0; i < db.shardCount; i++ {
-		groups[i], err = client.CreateShardGroup(db.database, db.Info.DefaultRetentionPolicy, ts)
+	var ts time.Time
+	for _, ts = range cfg.shardGroupStarts() {
+		sgi, err := client.CreateShardGroup(db.name, cfg.RP, ts)
 		if err != nil {
 			return err
 		}
-		if err = os.MkdirAll(filepath.Join(db.ShardPath, strconv.Itoa(int(groups[i].ID))), 0777); err != nil {
+		if sgi, err = db.addShards(client, rp, sgi); err != nil {
 			return err
 		}
-		ts = ts.Add(db.shardDuration)
+		for _, sh := range sgi.Shards {
+			if err = os.MkdirAll(filepath.Join(rp.ShardPath, strconv.Itoa(int(sh.ID))), 0777); err != nil {
+				return err
+			}
+		}
 	}
+	ts = ts.Add(cfg.ShardDuration.Duration)
 
-	db.Info = client.Database(db.database)
+	// precreated shard groups contain no data, so their shards are not created until written
+	for i := 0; i < cfg.Precreate; i++ {
+		sgi, err := client.CreateShardGroup(db.name, cfg.RP, ts)
+		if err != nil {
+			return err
+		}
+		if _, err = db.addShards(client, rp, sgi); err != nil {
+			return err
+		}
+		ts = ts.Add(cfg.ShardDuration.Duration)
+	}
 
 	return nil
 }
 
+// addShards adds shards to the shard group sgi, created with a single shard, until it
+// has ShardsPerGroup shards, returning the updated shard group. The meta client creates
+// a single shard per shard group, so the shards are added to the meta data directly.
+func (db *Database) addShards(client *meta.Client, rp *RetentionPolicy, sgi *meta.ShardGroupInfo) (*meta.ShardGroupInfo, error) {
+	if rp.Config.ShardsPerGroup <= len(sgi.Shards) {
+		return sgi, nil
+	}
+
+	data := client.Data()
+	rpi, err := data.RetentionPolicy(db.name, rp.Config.RP)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rpi.ShardGroups {
+		g := &rpi.ShardGroups[i]
+		if g.ID != sgi.ID {
+			continue
+		}
+		for len(g.Shards) < rp.Config.ShardsPerGroup {
+			data.MaxShardID++
+			g.Shards = append(g.Shards, meta.ShardInfo{ID: data.MaxShardID})
+		}
+		if err = client.SetData(&data); err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("shard group %d of %s/%s not found", sgi.ID, db.name, rp.Config.RP)
+}
+
+// RP returns the retention policy named name, or nil if none.
+func (db *Database) RP(name string) *RetentionPolicy {
+	for _, rp := range db.RPs {
+		if rp.Config.RP == name {
+			return rp
+		}
+	}
+	return nil
+}
+
+// ShardGroups returns the shard groups of the retention policy rp to be generated, once created,
+// excluding precreated shard groups.
+func (db *Database) ShardGroups(rp *RetentionPolicy) []meta.ShardGroupInfo {
+	return db.Info.RetentionPolicy(rp.Config.RP).ShardGroups[:rp.Config.ShardCount]
+}
+
 type Visitor interface {
 	Visit(node Node) Visitor
 }
@@ -141,8 +322,44 @@ type configValidator struct {
 func (v *configValidator) Visit(node Node) Visitor {
 	switch n := node.(type) {
 	case *DBConfig:
-		if n.StartTime.Add(n.TimeSpan()).After(time.Now()) {
-			v.errs = append(v.errs, fmt.Errorf("start time must be ≤ %s", time.Now().Truncate(n.ShardDuration.Duration).UTC().Add(-n.TimeSpan())))
+		now := time.Now()
+		// the shard groups of rollups may extend beyond the data rolled up
+		if !n.AllowFuture && n.raw == nil && n.EndTime().After(now) {
+			if len(n.Windows) > 0 {
+				v.errs = append(v.errs, fmt.Errorf("%s/%s: shard groups of windows end at %s, after the current time, unless future shard groups are allowed", n.Database, n.RP, n.EndTime()))
+			} else {
+				v.errs = append(v.errs, fmt.Errorf("start time must be ≤ %s, unless future shard groups are allowed", now.Truncate(n.ShardDuration.Duration).UTC().Add(-n.TimeSpan())))
+			}
+		}
+		for i := 1; i < len(n.Windows); i++ {
+			if n.Windows[i].Start.Before(n.Windows[i-1].End) {
+				v.errs = append(v.errs, fmt.Errorf("%s/%s: windows must be in time order and not overlap", n.Database, n.RP))
+				break
+			}
+		}
+		if _, err := parseDensity(n.Density, n.ShardCount); err != nil {
+			v.errs = append(v.errs, err)
+		}
+		if n.Precreate < 0 {
+			v.errs = append(v.errs, fmt.Errorf("precreated shard groups must be ≥ 0"))
+		}
+		if n.Churn < 0 || n.Churn > 1 {
+			v.errs = append(v.errs, fmt.Errorf("%s/%s: churn must be between 0 and 1", n.Database, n.RP))
+		}
+		if n.ShardsPerGroup < 1 {
+			v.errs = append(v.errs, fmt.Errorf("shards per group must be ≥ 1"))
+		}
+		if n.Replication < 0 {
+			v.errs = append(v.errs, fmt.Errorf("replication must be ≥ 0, where 0 is the default of 1"))
+		}
+		if n.ExpiredShards > 0 || n.Expiring {
+			if n.Duration.Duration == 0 {
+				v.errs = append(v.errs, fmt.Errorf("%s/%s: expired shards require a retention policy duration", n.Database, n.RP))
+			} else if n.ExpiredShards > n.ShardCount {
+				v.errs = append(v.errs, fmt.Errorf("%s/%s: expired shards must be ≤ shard count", n.Database, n.RP))
+			} else if got := n.expiredShards(now); got != n.ExpiredShards {
+				v.errs = append(v.errs, fmt.Errorf("%s/%s: start time %s results in %d expired shards, expected %d", n.Database, n.RP, n.StartTime, got, n.ExpiredShards))
+			}
 		}
 	}
 
@@ -165,6 +382,9 @@ func (v *configDefaults) Visit(node Node) Visitor {
 		if n.MetaPath == "" {
 			n.MetaPath = "${HOME}/.influxdb/meta"
 		}
+		if n.WALPath == "" {
+			n.WALPath = filepath.Join(filepath.Dir(n.DataPath), "wal")
+		}
 		if n.Database == "" {
 			n.Database = "db"
 		}
@@ -174,11 +394,24 @@ func (v *configDefaults) Visit(node Node) Visitor {
 		if n.ShardDuration.Duration == 0 {
 			n.ShardDuration.Duration = 24 * time.Hour
 		}
+		if len(n.Windows) > 0 {
+			n.StartTime = n.Windows[0].Start
+			n.ShardCount = len(n.shardGroupStarts())
+		}
 		if n.ShardCount == 0 {
 			n.ShardCount = 1
 		}
+		if n.ShardsPerGroup == 0 {
+			n.ShardsPerGroup = 1
+		}
 		if n.StartTime.IsZero() {
-			n.StartTime = time.Now().Truncate(n.ShardDuration.Duration).Add(-n.TimeSpan())
+			if (n.ExpiredShards > 0 || n.Expiring) && n.Duration.Duration > 0 {
+				// the oldest shard group within the duration is the next to expire
+				d := n.ShardDuration.Duration * time.Duration(n.ExpiredShards)
+				n.StartTime = n.retentionBoundary(time.Now()).Add(-d)
+			} else {
+				n.StartTime = time.Now().Truncate(n.ShardDuration.Duration).Add(-n.TimeSpan())
+			}
 		}
 	}
 
@@ -194,3 +427,44 @@ func (d *duration) UnmarshalText(text []byte) error {
 	d.Duration, err = time.ParseDuration(string(text))
 	return err
 }
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// timestamp is a time which may be specified relative to the current time, per parseTime.
+type timestamp struct {
+	time.Time
+}
+
+func (t *timestamp) UnmarshalText(text []byte) error {
+	var err error
+	t.Time, err = parseTime(string(text), time.Now())
+	return err
+}
+
+// parseTime parses s as an RFC3339 time, or a time relative to now, such as now, now-30d,
+// -7d or +12h. Relative durations may use the units of InfluxQL durations, including d and w.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	rel := s
+	if strings.HasPrefix(rel, "now") {
+		rel = rel[3:]
+		if rel == "" {
+			return now.UTC(), nil
+		}
+	}
+
+	if strings.HasPrefix(rel, "-") || strings.HasPrefix(rel, "+") {
+		d, err := influxql.ParseDuration(strings.TrimPrefix(rel, "+"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: %v", s, err)
+		}
+		return now.Add(d).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,127 @@
+package genshards
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/ingen"
+	"github.com/influxdata/ingen/pkg/gen"
+)
+
+// preset generates the series of a workload in place of the single measurement and field of
+// --values or --fields.
+type preset struct {
+	// Series returns the series generator of the shard group sgi, where keys and tv are the tag
+	// keys and values of the tag cardinalities, with points per series at intervals of delta.
+	Series func(cmd *command, keys []string, tv []gen.Sequence, sgi *meta.ShardGroupInfo, points int, delta time.Duration, seed int64) ingen.SeriesGenerator
+
+	// SeriesN is the number of series of each tag set.
+	SeriesN int
+
+	// Workload is the schema of the series, generated for --scale hosts in place of the tag
+	// sets of --t, if any.
+	Workload workload
+
+	// Fixed is set if the values cannot be changed by lifetimes or anomalies.
+	Fixed bool
+}
+
+var presets = map[string]preset{
+	"prometheus-histogram": {
+		Series:  prometheusSeries(&histogramMetric),
+		SeriesN: histogramMetric.SeriesN(),
+		Fixed:   true,
+	},
+	"prometheus-summary": {
+		Series:  prometheusSeries(&summaryMetric),
+		SeriesN: summaryMetric.SeriesN(),
+		Fixed:   true,
+	},
+	"prometheus": {
+		Series:  prometheusSeries(&histogramMetric, &summaryMetric),
+		SeriesN: histogramMetric.SeriesN() + summaryMetric.SeriesN(),
+		Fixed:   true,
+	},
+	"geo": {
+		Series: geoSeries,
+		Fixed:  true,
+	},
+	"devops": {
+		Series:   workloadSeries(devopsWorkload),
+		Workload: devopsWorkload,
+	},
+	"iot": {
+		Series:   workloadSeries(iotWorkload),
+		Workload: iotWorkload,
+	},
+	"k8s": {
+		Series:   workloadSeries(k8sWorkload),
+		Workload: k8sWorkload,
+	},
+	"telegraf-system": {
+		Series:   workloadSeries(telegrafSystemWorkload),
+		Workload: telegrafSystemWorkload,
+	},
+}
+
+// presetNames returns the names of the presets, sorted.
+func presetNames() string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+var (
+	histogramMetric = gen.PrometheusMetric{
+		Name:    "http_request_duration_seconds",
+		Type:    gen.PrometheusHistogram,
+		Buckets: gen.DefaultPrometheusBuckets,
+		Median:  0.1,
+		Sigma:   1,
+		Rate:    20,
+	}
+
+	summaryMetric = gen.PrometheusMetric{
+		Name:      "rpc_duration_seconds",
+		Type:      gen.PrometheusSummary,
+		Quantiles: gen.DefaultPrometheusQuantiles,
+		Median:    0.05,
+		Sigma:     0.5,
+		Rate:      20,
+	}
+)
+
+// prometheusSeries generates the series of each of metrics, which must be ordered by name.
+func prometheusSeries(metrics ...*gen.PrometheusMetric) func(*command, []string, []gen.Sequence, *meta.ShardGroupInfo, int, time.Duration, int64) ingen.SeriesGenerator {
+	return func(cmd *command, keys []string, tv []gen.Sequence, sgi *meta.ShardGroupInfo, points int, delta time.Duration, seed int64) ingen.SeriesGenerator {
+		gens := make([]ingen.SeriesGenerator, len(metrics))
+		for i, m := range metrics {
+			gens[i] = gen.NewPrometheusSeriesGenerator(m, keys, tv, points, sgi.StartTime, delta, seed)
+		}
+		return gen.NewConcatSeriesGenerator(gens...)
+	}
+}
+
+// geoConfig describes the trips of vehicles based around New York City.
+var geoConfig = gen.GeoConfig{
+	Home:    [2]s2.LatLng{s2.LatLngFromDegrees(40.60, -74.05), s2.LatLngFromDegrees(40.85, -73.75)},
+	Radius:  10000,
+	MinTrip: 10 * time.Minute,
+	MaxTrip: 90 * time.Minute,
+	MinIdle: 10 * time.Minute,
+	MaxIdle: 3 * time.Hour,
+}
+
+// geoSeries generates the tracks of a vehicle for each tag set, in the measurement fleet.
+func geoSeries(cmd *command, keys []string, tv []gen.Sequence, sgi *meta.ShardGroupInfo, points int, delta time.Duration, seed int64) ingen.SeriesGenerator {
+	cfg := geoConfig
+	cfg.Level = cmd.S2Level
+	tags := gen.NewTagsValuesSequenceKeysValues(keys, tv)
+	return gen.NewGeoSeriesGenerator([]byte("fleet"), tags, cfg, points, sgi.StartTime, delta, seed)
+}
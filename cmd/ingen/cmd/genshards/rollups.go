@@ -0,0 +1,126 @@
+package genshards
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+	"github.com/influxdata/ingen"
+	"github.com/influxdata/ingen/pkg/gen"
+)
+
+// Rollup is a retention policy holding the count, max, mean and min of each field of
+// the series of another retention policy over windows of Window, as a continuous query
+// would write. The shard groups of the retention policy are of ShardDuration.
+type Rollup struct {
+	Window        time.Duration
+	ShardDuration time.Duration // if zero, the shard duration of the rolled up retention policy
+
+	text string
+}
+
+func (r Rollup) String() string { return r.text }
+
+func (r Rollup) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+func (r *Rollup) UnmarshalText(text []byte) error {
+	var err error
+	*r, err = parseRollup(string(text))
+	return err
+}
+
+// parseRollup parses a rollup of the form window[:shard-duration], where each is an
+// InfluxQL duration, such as 1h:7d.
+func parseRollup(s string) (Rollup, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 2 {
+		return Rollup{}, fmt.Errorf("invalid rollup %q: expected window[:shard-duration]", s)
+	}
+
+	r := Rollup{text: s}
+	var err error
+	if r.Window, err = influxql.ParseDuration(parts[0]); err != nil || r.Window <= 0 {
+		return Rollup{}, fmt.Errorf("invalid rollup %q: window must be a duration > 0", s)
+	}
+	if len(parts) == 2 {
+		if r.ShardDuration, err = influxql.ParseDuration(parts[1]); err != nil || r.ShardDuration <= 0 {
+			return Rollup{}, fmt.Errorf("invalid rollup %q: shard duration must be a duration > 0", s)
+		}
+	}
+	return r, nil
+}
+
+// name returns the name of the retention policy of the rollup of the retention policy rp.
+func (r Rollup) name(rp string) string {
+	return rp + "_" + strings.SplitN(r.text, ":", 2)[0]
+}
+
+// rollupConfigs returns the configuration of the retention policy of each rollup of cfg,
+// which must have been validated. The shard groups of a rollup cover those of cfg, and
+// its retention policy is infinite.
+func (cfg *DBConfig) rollupConfigs() ([]*DBConfig, error) {
+	var res []*DBConfig
+	for i := range cfg.Rollups {
+		r := &cfg.Rollups[i]
+
+		sd := cfg.ShardDuration.Duration
+		if r.ShardDuration > 0 {
+			sd = r.ShardDuration
+		}
+		if cfg.ShardDuration.Duration%r.Window != 0 || sd%r.Window != 0 {
+			return nil, fmt.Errorf("%s/%s: rollup %s: window must divide the shard durations of both retention policies", cfg.Database, cfg.RP, r)
+		}
+
+		rc := &DBConfig{
+			DataPath:       cfg.DataPath,
+			MetaPath:       cfg.MetaPath,
+			WALPath:        cfg.WALPath,
+			Database:       cfg.Database,
+			RP:             r.name(cfg.RP),
+			Replication:    cfg.Replication,
+			AllowFuture:    cfg.AllowFuture,
+			ShardDuration:  duration{sd},
+			ShardsPerGroup: 1,
+			raw:            cfg,
+			rollup:         r,
+		}
+		for _, ts := range cfg.shardGroupStarts() {
+			if n := len(rc.Windows); n > 0 && rc.Windows[n-1].End.Equal(ts) {
+				rc.Windows[n-1].End = ts.Add(cfg.ShardDuration.Duration)
+				continue
+			}
+			rc.Windows = append(rc.Windows, Window{Start: ts, End: ts.Add(cfg.ShardDuration.Duration)})
+		}
+		res = append(res, rc)
+	}
+	return res, nil
+}
+
+// newRollupGenerators returns the series generator of each shard group of the rollup
+// retention policy cfg. The rollups of each shard group are computed from new series
+// generators of the shards of the shard groups of the rolled up retention policy which
+// overlap it, generated from seed exactly as those of rawGroups were by newSeriesGenerators.
+func (cmd *command) newRollupGenerators(cfg *DBConfig, groups []meta.ShardGroupInfo, rawGroups []meta.ShardGroupInfo, seed int64) []ingen.SeriesGenerator {
+	points := pointsPerShard(cfg.raw, cmd.PointsPerSeriesPerShard)
+	gens := make([]ingen.SeriesGenerator, len(groups))
+	for i := range groups {
+		sgi := &groups[i]
+
+		var raw []ingen.SeriesGenerator
+		offset := int64(0) // index of the first shard of the shard group, across all shard groups
+		for k := range rawGroups {
+			rsg := &rawGroups[k]
+			if rsg.StartTime.Before(sgi.EndTime) && rsg.EndTime.After(sgi.StartTime) {
+				for n := range rsg.Shards {
+					rg := cmd.newSeriesGenerator(cfg.raw, rsg, k, points[k], seed+offset+int64(n))
+					raw = append(raw, ingen.NewShardSeriesGenerator(rg, len(rsg.Shards), n))
+				}
+			}
+			offset += int64(len(rsg.Shards))
+		}
+		gens[i] = gen.NewRollupSeriesGenerator(raw, cfg.rollup.Window, sgi.StartTime, sgi.EndTime)
+	}
+	return gens
+}
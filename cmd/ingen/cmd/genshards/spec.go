@@ -0,0 +1,197 @@
+package genshards
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/influxdata/ingen"
+)
+
+// Spec declares the databases and retention policies created by a single run.
+//
+//	[[databases]]
+//	name = "tenant"
+//	count = 100            # creates tenant00 to tenant99
+//
+//	  [[databases.rps]]
+//	  name = "autogen"
+//	  default = true
+//	  duration = "168h"
+//	  shard-duration = "24h"
+//	  shard-count = 7
+//
+// Properties of a retention policy which are not specified take the values of
+// the corresponding command line options.
+type Spec struct {
+	Databases []DatabaseSpec `toml:"databases"`
+}
+
+// DatabaseSpec declares one or more databases with the same retention policies.
+type DatabaseSpec struct {
+	Name  string
+	Count int                   // if greater than 1, Count databases are created, suffixed with their index
+	RPs   []RetentionPolicySpec `toml:"rps"`
+}
+
+// RetentionPolicySpec declares a retention policy and its shard groups.
+type RetentionPolicySpec struct {
+	Name           string
+	Default        bool
+	Duration       duration
+	Replication    int
+	ExpiredShards  int `toml:"expired-shards"`
+	Expiring       *bool
+	ShardDuration  duration  `toml:"shard-duration"`
+	ShardCount     int       `toml:"shard-count"`
+	ShardsPerGroup int       `toml:"shards-per-group"`
+	StartTime      timestamp `toml:"start-time"`
+	AllowFuture    *bool     `toml:"allow-future"`
+	Precreate      int
+	Windows        []Window
+	Density        string
+	Churn          float64
+	Rollups        []Rollup
+}
+
+// ReadSpec reads a TOML spec from the file path.
+func ReadSpec(path string) (*Spec, error) {
+	spec := new(Spec)
+	md, err := toml.DecodeFile(path, spec)
+	if err != nil {
+		return nil, err
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return nil, fmt.Errorf("%s: unknown keys: %v", path, keys)
+	}
+	return spec, spec.validate()
+}
+
+func (s *Spec) validate() error {
+	var errs []error
+	if len(s.Databases) == 0 {
+		errs = append(errs, fmt.Errorf("spec: no databases"))
+	}
+	for i := range s.Databases {
+		d := &s.Databases[i]
+		if d.Name == "" {
+			errs = append(errs, fmt.Errorf("spec: database %d: name required", i))
+		}
+		if len(d.RPs) == 0 {
+			errs = append(errs, fmt.Errorf("spec: database %s: no retention policies", d.Name))
+		}
+
+		var (
+			names = make(map[string]bool)
+			defs  int
+		)
+		for j := range d.RPs {
+			rp := &d.RPs[j]
+			if rp.Name == "" {
+				errs = append(errs, fmt.Errorf("spec: database %s: retention policy %d: name required", d.Name, j))
+			} else if names[rp.Name] {
+				errs = append(errs, fmt.Errorf("spec: database %s: duplicate retention policy %s", d.Name, rp.Name))
+			}
+			names[rp.Name] = true
+			if rp.Default {
+				defs++
+			}
+		}
+		if defs > 1 {
+			errs = append(errs, fmt.Errorf("spec: database %s: more than one default retention policy", d.Name))
+		}
+	}
+	return ingen.NewErrorList(errs)
+}
+
+// configs returns the configuration of each retention policy of each database declared
+// by s. Properties not specified by s take the values of base.
+func (s *Spec) configs(base *DBConfig) ([][]*DBConfig, error) {
+	var (
+		dbs   [][]*DBConfig
+		names = make(map[string]bool)
+	)
+	for i := range s.Databases {
+		d := &s.Databases[i]
+		for _, name := range d.names() {
+			if names[name] {
+				return nil, fmt.Errorf("spec: duplicate database %s", name)
+			}
+			names[name] = true
+
+			var cfgs []*DBConfig
+			for j := range d.RPs {
+				cfg := d.RPs[j].config(base)
+				cfg.Database = name
+				cfgs = append(cfgs, cfg)
+			}
+			dbs = append(dbs, cfgs)
+		}
+	}
+	return dbs, nil
+}
+
+// names returns the name of each database declared by d.
+func (d *DatabaseSpec) names() []string {
+	if d.Count <= 1 {
+		return []string{d.Name}
+	}
+
+	w := int(math.Ceil(math.Log10(float64(d.Count))))
+	f := fmt.Sprintf("%s%%0%dd", strings.Replace(d.Name, "%", "%%", -1), w)
+	names := make([]string, d.Count)
+	for i := range names {
+		names[i] = fmt.Sprintf(f, i)
+	}
+	return names
+}
+
+func (rp *RetentionPolicySpec) config(base *DBConfig) *DBConfig {
+	cfg := *base
+	cfg.RP = rp.Name
+	cfg.Default = rp.Default
+	if rp.Duration.Duration > 0 {
+		cfg.Duration = rp.Duration
+	}
+	if rp.Replication > 0 {
+		cfg.Replication = rp.Replication
+	}
+	if rp.ExpiredShards > 0 {
+		cfg.ExpiredShards = rp.ExpiredShards
+	}
+	if rp.Expiring != nil {
+		cfg.Expiring = *rp.Expiring
+	}
+	if rp.ShardDuration.Duration > 0 {
+		cfg.ShardDuration = rp.ShardDuration
+	}
+	if rp.ShardCount > 0 {
+		cfg.ShardCount = rp.ShardCount
+	}
+	if rp.ShardsPerGroup > 0 {
+		cfg.ShardsPerGroup = rp.ShardsPerGroup
+	}
+	if !rp.StartTime.IsZero() {
+		cfg.StartTime = rp.StartTime.Time
+	}
+	if rp.Precreate > 0 {
+		cfg.Precreate = rp.Precreate
+	}
+	if rp.AllowFuture != nil {
+		cfg.AllowFuture = *rp.AllowFuture
+	}
+	if len(rp.Windows) > 0 {
+		cfg.Windows = rp.Windows
+	}
+	if rp.Density != "" {
+		cfg.Density = rp.Density
+	}
+	if rp.Churn > 0 {
+		cfg.Churn = rp.Churn
+	}
+	if len(rp.Rollups) > 0 {
+		cfg.Rollups = rp.Rollups
+	}
+	return &cfg
+}
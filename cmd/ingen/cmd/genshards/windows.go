@@ -0,0 +1,108 @@
+package genshards
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a time range covered by contiguous shard groups. The shard groups of a
+// retention policy with several windows have gaps between the windows.
+type Window struct {
+	Start, End time.Time
+}
+
+func (w Window) String() string {
+	return w.Start.Format(time.RFC3339) + "/" + w.End.Format(time.RFC3339)
+}
+
+func (w Window) MarshalText() ([]byte, error) { return []byte(w.String()), nil }
+
+func (w *Window) UnmarshalText(text []byte) error {
+	var err error
+	*w, err = parseWindow(string(text), time.Now())
+	return err
+}
+
+// parseWindow parses a window of the form start/end, where each time is as accepted by parseTime.
+func parseWindow(s string, now time.Time) (Window, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Window{}, fmt.Errorf("invalid window %q: expected start/end", s)
+	}
+
+	var (
+		w   Window
+		err error
+	)
+	if w.Start, err = parseTime(parts[0], now); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %v", s, err)
+	}
+	if w.End, err = parseTime(parts[1], now); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %v", s, err)
+	}
+	if !w.End.After(w.Start) {
+		return Window{}, fmt.Errorf("invalid window %q: end must be after start", s)
+	}
+	return w, nil
+}
+
+// parseDensity parses the relative density of points of each of n shard groups, in time order,
+// which is either a comma-separated list of factors, repeated as necessary to cover the shard
+// groups, or ramp:<from>:<to>, increasing linearly from the first to the last shard group.
+// If s is empty, each shard group has a density of 1.
+func parseDensity(s string, n int) ([]float64, error) {
+	d := make([]float64, n)
+	if s == "" {
+		for i := range d {
+			d[i] = 1
+		}
+		return d, nil
+	}
+
+	if strings.HasPrefix(s, "ramp:") {
+		parts := strings.Split(s[len("ramp:"):], ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid density %q: expected ramp:<from>:<to>", s)
+		}
+		from, err1 := strconv.ParseFloat(parts[0], 64)
+		to, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil || from <= 0 || to <= 0 {
+			return nil, fmt.Errorf("invalid density %q: factors must be > 0", s)
+		}
+		for i := range d {
+			if n == 1 {
+				d[i] = from
+				continue
+			}
+			d[i] = from + (to-from)*float64(i)/float64(n-1)
+		}
+		return d, nil
+	}
+
+	var factors []float64
+	for _, v := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("invalid density %q: factors must be > 0", s)
+		}
+		factors = append(factors, f)
+	}
+	for i := range d {
+		d[i] = factors[i%len(factors)]
+	}
+	return d, nil
+}
+
+// pointsPerShard returns the number of points per series of each shard group of cfg,
+// given the points per series of a shard group of density 1.
+func pointsPerShard(cfg *DBConfig, points int) []int {
+	d, _ := parseDensity(cfg.Density, cfg.ShardCount) // validated by configValidator
+	p := make([]int, len(d))
+	for i := range d {
+		p[i] = int(math.Max(1, math.Round(float64(points)*d[i])))
+	}
+	return p
+}
@@ -0,0 +1,427 @@
+package genshards
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/ingen"
+	"github.com/influxdata/ingen/pkg/gen"
+)
+
+// workload is the schema of the measurements of a preset, generated for the number of
+// hosts, devices or nodes of --scale.
+type workload []workloadMeasurement
+
+// workloadMeasurement describes a measurement of a workload.
+type workloadMeasurement struct {
+	Name string
+
+	// Tags returns the tag set of each series of the measurement, for scale hosts.
+	Tags func(scale int) []models.Tags
+
+	// Fields is the model of the fields of each series.
+	Fields gen.FieldsModel
+}
+
+// workloadTags returns the tag sets of the measurement m of the workload preset for --scale
+// hosts, sorted by series key. The tag sets of each measurement are computed once and shared
+// by the generators of every shard, which each iterate a clone of the returned sequence.
+func (cmd *command) workloadTags(m *workloadMeasurement) *gen.TagsListSequence {
+	if tags, ok := cmd.wtags[m.Name]; ok {
+		return tags
+	}
+	if cmd.wtags == nil {
+		cmd.wtags = make(map[string]*gen.TagsListSequence)
+	}
+	tags := gen.NewTagsListSequence(m.Tags(cmd.Scale))
+	cmd.wtags[m.Name] = tags
+	return tags
+}
+
+// workloadSeriesN returns the number of series of the workload w for --scale hosts.
+func (cmd *command) workloadSeriesN(w workload) int {
+	n := 0
+	for i := range w {
+		n += cmd.workloadTags(&w[i]).Count()
+	}
+	return n
+}
+
+// workloadSeries generates the series of each measurement of w in turn. The fields of each
+// series are related as those of --fields, and subject to lifetimes and anomalies.
+func workloadSeries(w workload) func(*command, []string, []gen.Sequence, *meta.ShardGroupInfo, int, time.Duration, int64) ingen.SeriesGenerator {
+	w = append(workload(nil), w...)
+	sort.Slice(w, func(i, j int) bool { return w[i].Name < w[j].Name })
+
+	return func(cmd *command, _ []string, _ []gen.Sequence, sgi *meta.ShardGroupInfo, points int, delta time.Duration, seed int64) ingen.SeriesGenerator {
+		gens := make([]ingen.SeriesGenerator, len(w))
+		for i := range w {
+			m := &w[i]
+
+			// the values of each measurement are drawn from a source seeded from its name
+			h := models.NewInlineFNV64a()
+			h.Write([]byte(m.Name))
+			seed := seed ^ int64(h.Sum64())
+
+			fields := m.Fields.Fields()
+			vgs := make([]ingen.ValuesSequence, len(fields))
+			for j, vg := range gen.NewFieldValuesSequences(m.Fields.Clone(), points, sgi.StartTime, delta, rand.New(rand.NewSource(seed))) {
+				vgs[j] = cmd.decorateValues(vg, sgi, seed)
+			}
+			gens[i] = gen.NewFieldsSeriesGenerator([]byte(m.Name), fields, vgs, cmd.workloadTags(m).Clone())
+		}
+		return gen.NewConcatSeriesGenerator(gens...)
+	}
+}
+
+// entities returns the tags of each of n hosts, devices or nodes, where tags returns the tags
+// of entity i. Any random attributes are drawn from r, seeded by i, so the attributes of an
+// entity do not depend on n.
+func entities(n int, tags func(i int, r *rand.Rand) map[string]string) []models.Tags {
+	res := make([]models.Tags, n)
+	for i := range res {
+		res[i] = models.NewTags(tags(i, rand.New(rand.NewSource(int64(i)))))
+	}
+	return res
+}
+
+// cross returns the product of the tag sets of sets and each value of the tag key.
+func cross(sets []models.Tags, key string, vals ...string) []models.Tags {
+	res := make([]models.Tags, 0, len(sets)*len(vals))
+	for _, t := range sets {
+		for _, v := range vals {
+			res = append(res, t.Merge(map[string]string{key: v}))
+		}
+	}
+	return res
+}
+
+func pick(r *rand.Rand, vals ...string) string { return vals[r.Intn(len(vals))] }
+
+const gib = 1 << 30
+
+var cpuUsageFields = []string{
+	"usage_guest", "usage_guest_nice", "usage_idle", "usage_iowait", "usage_irq",
+	"usage_nice", "usage_softirq", "usage_steal", "usage_system", "usage_user",
+}
+
+// devopsHosts returns the tags of n servers of a fleet of services across cloud regions.
+func devopsHosts(n int) []models.Tags {
+	return entities(n, func(i int, r *rand.Rand) map[string]string {
+		region := pick(r, "ap-northeast-1", "ap-southeast-1", "ap-southeast-2", "eu-central-1", "eu-west-1", "sa-east-1", "us-east-1", "us-west-1", "us-west-2")
+		return map[string]string{
+			"hostname":            fmt.Sprintf("host_%d", i),
+			"region":              region,
+			"datacenter":          region + pick(r, "a", "b", "c"),
+			"rack":                fmt.Sprint(r.Intn(100)),
+			"os":                  pick(r, "Ubuntu16.04LTS", "Ubuntu16.10", "Ubuntu15.10"),
+			"arch":                pick(r, "x64", "x86"),
+			"team":                pick(r, "CHI", "LON", "NYC", "SF"),
+			"service":             fmt.Sprint(r.Intn(20)),
+			"service_version":     fmt.Sprint(r.Intn(2)),
+			"service_environment": pick(r, "production", "staging", "test"),
+		}
+	})
+}
+
+var devopsWorkload = workload{
+	{
+		Name:   "cpu",
+		Tags:   devopsHosts,
+		Fields: gen.NewSumFieldsModel(cpuUsageFields, 100),
+	},
+	{
+		Name: "disk",
+		Tags: func(n int) []models.Tags { return cross(cross(devopsHosts(n), "fstype", "ext4"), "path", "/", "/var") },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCapacityFieldsModel("total", "used", "free", "used_percent", 50*gib, 2000*gib),
+			gen.NewCapacityFieldsModel("inodes_total", "inodes_used", "inodes_free", "", 1e6, 1e8),
+		),
+	},
+	{
+		Name: "diskio",
+		Tags: func(n int) []models.Tags { return cross(devopsHosts(n), "name", "sda", "sdb") },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCounterFieldsModel([]string{"reads", "read_bytes", "read_time"}, []int64{1, 4096, 2}),
+			gen.NewCounterFieldsModel([]string{"writes", "write_bytes", "write_time"}, []int64{1, 4096, 3}),
+			gen.NewCounterFieldsModel([]string{"io_time"}, []int64{5}),
+		),
+	},
+	{
+		Name: "kernel",
+		Tags: devopsHosts,
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewGaugeFieldsModel([]gen.GaugeField{{Name: "boot_time", Min: 1.5e9, Max: 1.6e9, Integer: true}}),
+			gen.NewCounterFieldsModel([]string{"context_switches", "interrupts"}, []int64{1000, 400}),
+			gen.NewCounterFieldsModel([]string{"disk_pages_in", "disk_pages_out"}, []int64{10, 40}),
+			gen.NewCounterFieldsModel([]string{"processes_forked"}, []int64{1}),
+		),
+	},
+	{
+		Name: "mem",
+		Tags: devopsHosts,
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCapacityFieldsModel("total", "used", "available", "used_percent", 4*gib, 256*gib),
+			gen.NewGaugeFieldsModel([]gen.GaugeField{
+				{Name: "buffered", Min: 0, Max: gib, Step: 1 << 20, Integer: true},
+				{Name: "cached", Min: 0, Max: 4 * gib, Step: 4 << 20, Integer: true},
+			}),
+		),
+	},
+	{
+		Name: "net",
+		Tags: func(n int) []models.Tags { return cross(devopsHosts(n), "interface", "eth0", "eth1") },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCounterFieldsModel([]string{"packets_recv", "bytes_recv"}, []int64{100, 120000}),
+			gen.NewCounterFieldsModel([]string{"packets_sent", "bytes_sent"}, []int64{100, 80000}),
+		),
+	},
+	{
+		Name: "nginx",
+		Tags: func(n int) []models.Tags { return cross(devopsHosts(n), "port", "80") },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCounterFieldsModel([]string{"accepts", "handled", "requests"}, []int64{10, 10, 30}),
+			gen.NewGaugeFieldsModel([]gen.GaugeField{
+				{Name: "active", Min: 0, Max: 1000, Step: 10, Daily: 200, Integer: true},
+				{Name: "reading", Min: 0, Max: 50, Step: 2, Integer: true},
+				{Name: "waiting", Min: 0, Max: 500, Step: 5, Daily: 100, Integer: true},
+				{Name: "writing", Min: 0, Max: 100, Step: 2, Integer: true},
+			}),
+		),
+	},
+}
+
+// iotTrucks returns the tags of n trucks of a delivery fleet.
+func iotTrucks(n int) []models.Tags {
+	return entities(n, func(i int, r *rand.Rand) map[string]string {
+		return map[string]string{
+			"name":           fmt.Sprintf("truck_%d", i),
+			"fleet":          pick(r, "East", "North", "South", "West"),
+			"driver":         pick(r, "Albert", "Derek", "Andy", "Seth", "Trish", "Rodney"),
+			"model":          pick(r, "F-150", "G-2000", "H-2"),
+			"device_version": pick(r, "v1.0", "v1.5", "v2.0", "v2.3"),
+		}
+	})
+}
+
+var iotWorkload = workload{
+	{
+		Name: "diagnostics",
+		Tags: iotTrucks,
+		Fields: gen.NewGaugeFieldsModel([]gen.GaugeField{
+			{Name: "current_load", Min: 0, Max: 5000, Step: 50},
+			{Name: "fuel_state", Min: 0, Max: 1, Step: 0.005},
+			{Name: "status", Min: 0, Max: 4, Step: 0.2, Integer: true},
+		}),
+	},
+	{
+		Name: "readings",
+		Tags: iotTrucks,
+		Fields: gen.NewGaugeFieldsModel([]gen.GaugeField{
+			{Name: "elevation", Min: 0, Max: 5000, Step: 5},
+			{Name: "fuel_consumption", Min: 0, Max: 50, Step: 0.5},
+			{Name: "grade", Min: 0, Max: 100, Step: 1},
+			{Name: "heading", Min: 0, Max: 360, Step: 5},
+			{Name: "latitude", Min: -90, Max: 90, Step: 0.001},
+			{Name: "longitude", Min: -180, Max: 180, Step: 0.001},
+			{Name: "velocity", Min: 0, Max: 100, Step: 2, Daily: 20},
+		}),
+	},
+}
+
+// k8sNodes returns the tags of n nodes of a Kubernetes cluster.
+func k8sNodes(n int) []models.Tags {
+	return entities(n, func(i int, _ *rand.Rand) map[string]string {
+		return map[string]string{"node_name": fmt.Sprintf("node-%d", i)}
+	})
+}
+
+// k8sDeployments are the deployments of each namespace, whose pods are scheduled across the nodes.
+var k8sDeployments = map[string][]string{
+	"default":     {"api", "frontend", "worker"},
+	"kube-system": {"coredns", "metrics-server"},
+	"monitoring":  {"grafana", "prometheus"},
+	"payments":    {"ledger", "payments-api"},
+}
+
+// k8sPodsPerNode is the number of pods of deployments running on each node,
+// in addition to those of the kube-proxy and fluent-bit daemon sets.
+const k8sPodsPerNode = 20
+
+// k8sPods returns the tags of the pods of n nodes, each with a container of the same name if
+// containers is set. Application pods outside kube-system also have an istio-proxy container.
+func k8sPods(n int, containers bool) []models.Tags {
+	var namespaces []string
+	for ns := range k8sDeployments {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	suffix := func(r *rand.Rand, n int) string {
+		const chars = "bcdfghjklmnpqrstvwxz2456789"
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = chars[r.Intn(len(chars))]
+		}
+		return string(b)
+	}
+
+	var res []models.Tags
+	for i, node := range k8sNodes(n) {
+		r := rand.New(rand.NewSource(int64(i)))
+		add := func(ns, pod, app string, sidecar bool) {
+			t := node.Merge(map[string]string{"namespace": ns, "pod_name": pod})
+			switch {
+			case !containers:
+				res = append(res, t)
+			case sidecar:
+				res = append(res, cross([]models.Tags{t}, "container_name", app, "istio-proxy")...)
+			default:
+				res = append(res, cross([]models.Tags{t}, "container_name", app)...)
+			}
+		}
+
+		add("kube-system", "kube-proxy-"+suffix(r, 5), "kube-proxy", false)
+		add("kube-system", "fluent-bit-"+suffix(r, 5), "fluent-bit", false)
+		for j := 0; j < k8sPodsPerNode; j++ {
+			ns := namespaces[r.Intn(len(namespaces))]
+			app := pick(r, k8sDeployments[ns]...)
+
+			// the pods of a deployment share the hash of its replica set
+			h := models.NewInlineFNV64a()
+			h.Write([]byte(app))
+			rs := suffix(rand.New(rand.NewSource(int64(h.Sum64()))), 10)
+			add(ns, app+"-"+rs+"-"+suffix(r, 5), app, ns != "kube-system")
+		}
+	}
+	return res
+}
+
+var k8sWorkload = workload{
+	{
+		Name: "kubernetes_node",
+		Tags: k8sNodes,
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewGaugeFieldsModel([]gen.GaugeField{{Name: "cpu_usage_nanocores", Min: 1e8, Max: 8e9, Step: 5e7, Daily: 1e9, Integer: true}}),
+			gen.NewCapacityFieldsModel("", "memory_usage_bytes", "memory_available_bytes", "", 16*gib, 64*gib),
+			gen.NewCapacityFieldsModel("fs_capacity_bytes", "fs_used_bytes", "fs_available_bytes", "", 100*gib, 500*gib),
+			gen.NewCounterFieldsModel([]string{"network_rx_bytes"}, []int64{100000}),
+			gen.NewCounterFieldsModel([]string{"network_tx_bytes"}, []int64{80000}),
+		),
+	},
+	{
+		Name: "kubernetes_pod_container",
+		Tags: func(n int) []models.Tags { return k8sPods(n, true) },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewGaugeFieldsModel([]gen.GaugeField{
+				{Name: "cpu_usage_nanocores", Min: 1e6, Max: 2e9, Step: 1e7, Daily: 1e8, Integer: true},
+				{Name: "logsfs_used_bytes", Min: 0, Max: gib, Step: 1 << 20, Integer: true},
+				{Name: "memory_usage_bytes", Min: 1e7, Max: 2e9, Step: 1e6, Integer: true},
+				{Name: "restarts_total", Min: 0, Max: 3, Integer: true},
+				{Name: "rootfs_used_bytes", Min: 0, Max: gib, Step: 1 << 20, Integer: true},
+			}),
+		),
+	},
+	{
+		Name: "kubernetes_pod_network",
+		Tags: func(n int) []models.Tags { return k8sPods(n, false) },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCounterFieldsModel([]string{"rx_bytes"}, []int64{10000}),
+			gen.NewCounterFieldsModel([]string{"tx_bytes"}, []int64{8000}),
+		),
+	},
+}
+
+// telegrafHosts returns the tags of n hosts running Telegraf with its default inputs.
+func telegrafHosts(n int) []models.Tags {
+	return entities(n, func(i int, _ *rand.Rand) map[string]string {
+		return map[string]string{"host": fmt.Sprintf("host-%d", i)}
+	})
+}
+
+// telegrafDisks returns the tags of the root and boot partitions of n hosts.
+func telegrafDisks(n int) []models.Tags {
+	var res []models.Tags
+	for _, t := range telegrafHosts(n) {
+		res = append(res,
+			t.Merge(map[string]string{"device": "sda1", "fstype": "ext4", "mode": "rw", "path": "/"}),
+			t.Merge(map[string]string{"device": "sda2", "fstype": "ext4", "mode": "rw", "path": "/boot"}),
+		)
+	}
+	return res
+}
+
+var telegrafSystemWorkload = workload{
+	{
+		Name: "cpu",
+		Tags: func(n int) []models.Tags {
+			return cross(telegrafHosts(n), "cpu", "cpu-total", "cpu0", "cpu1", "cpu2", "cpu3")
+		},
+		Fields: gen.NewSumFieldsModel(cpuUsageFields, 100),
+	},
+	{
+		Name: "disk",
+		Tags: telegrafDisks,
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCapacityFieldsModel("total", "used", "free", "used_percent", 20*gib, 500*gib),
+			gen.NewCapacityFieldsModel("inodes_total", "inodes_used", "inodes_free", "", 1e6, 3e7),
+		),
+	},
+	{
+		Name: "diskio",
+		Tags: func(n int) []models.Tags { return cross(telegrafHosts(n), "name", "sda", "sda1", "sda2") },
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCounterFieldsModel([]string{"reads", "read_bytes", "read_time"}, []int64{1, 4096, 2}),
+			gen.NewCounterFieldsModel([]string{"writes", "write_bytes", "write_time"}, []int64{1, 4096, 3}),
+			gen.NewCounterFieldsModel([]string{"io_time", "weighted_io_time"}, []int64{5, 6}),
+			gen.NewGaugeFieldsModel([]gen.GaugeField{{Name: "iops_in_progress", Min: 0, Max: 10, Step: 1, Integer: true}}),
+		),
+	},
+	{
+		Name: "mem",
+		Tags: telegrafHosts,
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCapacityFieldsModel("total", "used", "available", "used_percent", 4*gib, 64*gib),
+			gen.NewGaugeFieldsModel([]gen.GaugeField{
+				{Name: "buffered", Min: 0, Max: gib, Step: 1 << 20, Integer: true},
+				{Name: "cached", Min: 0, Max: 4 * gib, Step: 4 << 20, Integer: true},
+			}),
+		),
+	},
+	{
+		Name: "processes",
+		Tags: telegrafHosts,
+		Fields: gen.NewGaugeFieldsModel([]gen.GaugeField{
+			{Name: "blocked", Min: 0, Max: 5, Step: 0.5, Integer: true},
+			{Name: "running", Min: 0, Max: 10, Step: 1, Integer: true},
+			{Name: "sleeping", Min: 100, Max: 400, Step: 2, Integer: true},
+			{Name: "stopped", Min: 0, Max: 1, Step: 0.05, Integer: true},
+			{Name: "total_threads", Min: 200, Max: 1500, Step: 5, Integer: true},
+			{Name: "zombies", Min: 0, Max: 3, Step: 0.1, Integer: true},
+		}),
+	},
+	{
+		Name: "swap",
+		Tags: telegrafHosts,
+		Fields: gen.NewCompositeFieldsModel(
+			gen.NewCapacityFieldsModel("total", "used", "free", "used_percent", gib, 8*gib),
+			gen.NewCounterFieldsModel([]string{"in"}, []int64{4096}),
+			gen.NewCounterFieldsModel([]string{"out"}, []int64{4096}),
+		),
+	},
+	{
+		Name: "system",
+		Tags: telegrafHosts,
+		Fields: gen.NewGaugeFieldsModel([]gen.GaugeField{
+			{Name: "load1", Min: 0, Max: 8, Step: 0.2, Daily: 1},
+			{Name: "load15", Min: 0, Max: 8, Step: 0.05, Daily: 1},
+			{Name: "load5", Min: 0, Max: 8, Step: 0.1, Daily: 1},
+			{Name: "n_cpus", Min: 4, Max: 4, Integer: true},
+			{Name: "n_users", Min: 0, Max: 5, Step: 0.1, Integer: true},
+		}),
+	},
+}
@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/influxdata/ingen"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Inspect the manifest of a generated database",
+	}
+	cmd.AddCommand(newCheck())
+	return cmd
+}
+
+type check struct {
+	Concurrency int
+	WALPath     string
+}
+
+func newCheck() *cobra.Command {
+	var o check
+	cmd := &cobra.Command{
+		Use:   "check <database path>",
+		Short: "Verify the checksums of all files recorded in the manifest",
+		Args:  cobra.ExactArgs(1),
+		RunE:  o.Run,
+	}
+
+	fs := cmd.Flags()
+	fs.IntVar(&o.Concurrency, "c", 1, "Concurrency")
+	fs.StringVar(&o.WALPath, "wal-path", "", "WAL directory of the database (default is that recorded in the manifest)")
+
+	return cmd
+}
+
+func (cmd *check) Run(_ *cobra.Command, args []string) error {
+	m, err := ingen.ReadManifest(args[0])
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 25, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Version\t%s\n", m.Version)
+	fmt.Fprintf(tw, "Database\t%s\n", m.Database)
+	fmt.Fprintf(tw, "Seed\t%d\n", m.Seed)
+	fmt.Fprintf(tw, "Generated\t%s (%s)\n", m.StartTime, m.Elapsed)
+	fmt.Fprintf(tw, "Shards\t%d\n", len(m.Shards))
+	fmt.Fprintf(tw, "Files\t%d\n", len(m.Files))
+	if len(m.WALFiles) > 0 {
+		fmt.Fprintf(tw, "WAL files\t%d\n", len(m.WALFiles))
+	}
+	tw.Flush()
+
+	if err := m.Verify(args[0], cmd.WALPath, cmd.Concurrency); err != nil {
+		fmt.Println()
+		fmt.Print(err)
+		return errors.New("manifest check failed")
+	}
+
+	fmt.Println()
+	fmt.Println("OK")
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/influxdata/ingen/cmd/ingen/cmd/buildindex"
 	"github.com/influxdata/ingen/cmd/ingen/cmd/genshards"
+	"github.com/influxdata/ingen/cmd/ingen/cmd/manifest"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -36,6 +38,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.ingen.yaml)")
 
 	rootCmd.AddCommand(genshards.New())
+	rootCmd.AddCommand(manifest.New())
+	rootCmd.AddCommand(buildindex.New())
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,164 @@
+package ingen
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+)
+
+// Delete describes series, or a time range of series, which are deleted once generated.
+// The values are written and subsequently deleted, such that the shards contain
+// tombstones as if the delete were issued to influxd.
+type Delete struct {
+	Measurement string            // if empty, matches series of any measurement
+	Tags        map[string]string // series must have all tags
+	Start, End  time.Time         // if zero, the time range is unbounded
+}
+
+// Matches returns true if the series identified by name and tags is deleted by d.
+func (d *Delete) Matches(name []byte, tags models.Tags) bool {
+	if d.Measurement != "" && d.Measurement != string(name) {
+		return false
+	}
+	for k, v := range d.Tags {
+		if string(tags.Get([]byte(k))) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// DropsSeries returns true if d deletes all values of the series, removing it from the index.
+func (d *Delete) DropsSeries() bool { return d.Start.IsZero() && d.End.IsZero() }
+
+// TimeRange returns the time range of the delete in nanoseconds.
+func (d *Delete) TimeRange() (min, max int64) {
+	min, max = math.MinInt64, math.MaxInt64
+	if !d.Start.IsZero() {
+		min = d.Start.UnixNano()
+	}
+	if !d.End.IsZero() {
+		max = d.End.UnixNano()
+	}
+	return min, max
+}
+
+// deleteSet records the keys matching each delete, in the order written.
+type deleteSet struct {
+	deletes []Delete
+	keys    [][][]byte
+	series  [][]byte // series keys which are dropped
+}
+
+func newDeleteSet(deletes []Delete) *deleteSet {
+	return &deleteSet{deletes: deletes, keys: make([][][]byte, len(deletes))}
+}
+
+// add records key, which is the TSM key of the series identified by seriesKey, name and tags.
+func (s *deleteSet) add(key, seriesKey, name []byte, tags models.Tags) {
+	dropped := false
+	for i := range s.deletes {
+		d := &s.deletes[i]
+		if !d.Matches(name, tags) {
+			continue
+		}
+		s.keys[i] = append(s.keys[i], key)
+		if d.DropsSeries() && !dropped {
+			dropped = true
+			if n := len(s.series); n == 0 || !bytes.Equal(s.series[n-1], seriesKey) {
+				s.series = append(s.series, seriesKey)
+			}
+		}
+	}
+}
+
+// merge appends the keys of o, which must follow those of s in key order.
+func (s *deleteSet) merge(o *deleteSet) {
+	for i := range s.keys {
+		s.keys[i] = append(s.keys[i], o.keys[i]...)
+	}
+	s.series = append(s.series, o.series...)
+}
+
+// writeTombstones deletes the matched keys from each TSM file in dir and from wal.
+func (s *deleteSet) writeTombstones(dir string, wal *tsm1.WAL) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.TSMFileExtension))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		if err := s.deleteTSM(name); err != nil {
+			return err
+		}
+	}
+
+	if wal == nil {
+		return nil
+	}
+	for i := range s.deletes {
+		if len(s.keys[i]) == 0 {
+			continue
+		}
+		min, max := s.deletes[i].TimeRange()
+		if _, err := wal.DeleteRange(s.keys[i], min, max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *deleteSet) deleteTSM(name string) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	r, err := tsm1.NewTSMReader(fd)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	defer r.Close()
+
+	for i := range s.deletes {
+		min, max := s.deletes[i].TimeRange()
+		if err := r.DeleteRange(s.keys[i], min, max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropSeries removes the dropped series from the TSI index of the shard,
+// returning their IDs so they may be deleted from the series file.
+func (s *deleteSet) dropSeries(sfile *tsdb.SeriesFile, ti *tsi1.Index) ([]uint64, error) {
+	var (
+		ids []uint64
+		buf []byte
+	)
+	for _, key := range s.series {
+		name, tags := models.ParseKeyBytes(key)
+		id := sfile.SeriesID(name, tags, buf)
+		if id == 0 {
+			continue
+		}
+		ids = append(ids, id)
+
+		if ti != nil {
+			if err := ti.DropSeries(id, key, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,170 @@
+package ingen
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// duplicateWriter writes every value to w and rewrites a fraction of the values to
+// each of several newer generations, with the same timestamp and a different value.
+// As newer generations take precedence, a point's value is that of the newest
+// generation to duplicate it, as determined by DuplicateValue.
+//
+// Each duplicate block spans exactly the time range of the values written to w by the
+// same call, by also rewriting its first and last values with their value as of that
+// generation. Blocks of a key then either share a time range or are disjoint, as the
+// KeyCursor of tsm1 only orders overlapping blocks by file, and otherwise by time.
+type duplicateWriter struct {
+	w    blockWriter
+	dups []blockWriter
+	buf  tsm1.Values
+	key  []byte
+	hash uint64
+	frac float64
+	vals []tsm1.Value
+	err  error
+}
+
+func newDuplicateWriter(w blockWriter, dups []blockWriter, frac float64) *duplicateWriter {
+	return &duplicateWriter{
+		w:    w,
+		dups: dups,
+		frac: frac,
+	}
+}
+
+func (w *duplicateWriter) Write(key []byte, values tsm1.Values) {
+	w.w.Write(key, values)
+	w.duplicate(key, values)
+}
+
+func (w *duplicateWriter) WriteBlock(key []byte, minTime, maxTime int64, block []byte) {
+	w.w.WriteBlock(key, minTime, maxTime, block)
+	if w.err != nil {
+		return
+	}
+
+	var err error
+	w.vals, err = tsm1.DecodeBlock(block, w.vals[:0])
+	if err != nil {
+		w.err = fmt.Errorf("decoding block of %q: %v", key, err)
+		return
+	}
+	w.duplicate(key, w.vals)
+}
+
+func (w *duplicateWriter) duplicate(key []byte, values tsm1.Values) {
+	if w.err != nil || len(values) == 0 {
+		return
+	}
+
+	if !bytes.Equal(key, w.key) {
+		h := fnv.New64a()
+		h.Write(key)
+		w.key, w.hash = key, h.Sum64()
+	}
+
+	last := len(values) - 1
+	for k := range w.dups {
+		w.buf = w.buf[:0]
+		n := 0
+		for i, v := range values {
+			if IsDuplicate(w.hash, v.UnixNano(), k, w.frac) {
+				n++
+				dv, err := DuplicateValue(v, k)
+				if err != nil {
+					w.err = fmt.Errorf("duplicating %q: %v", key, err)
+					return
+				}
+				w.buf = append(w.buf, dv)
+			} else if i == 0 || i == last {
+				// extend the block to the time range of values
+				ev, err := expectedValue(w.hash, v, k, w.frac)
+				if err != nil {
+					w.err = fmt.Errorf("duplicating %q: %v", key, err)
+					return
+				}
+				w.buf = append(w.buf, ev)
+			}
+		}
+
+		if n > 0 {
+			w.dups[k].Write(w.key, w.buf)
+		}
+	}
+}
+
+// Flush writes the remaining values of the current key.
+func (w *duplicateWriter) Flush() {
+	if f, ok := w.w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+func (w *duplicateWriter) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.w.Err(); err != nil {
+		return err
+	}
+	for _, bw := range w.dups {
+		if err := bw.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpectedValue returns the value queries should return for the point v of key, given
+// n duplicate generations rewriting approximately frac values each.
+func ExpectedValue(key []byte, v tsm1.Value, n int, frac float64) (tsm1.Value, error) {
+	h := fnv.New64a()
+	h.Write(key)
+	return expectedValue(h.Sum64(), v, n-1, frac)
+}
+
+// expectedValue returns the value of the point v of the key with the FNV-1a hash keyHash
+// once duplicate generations 0 to k have been written.
+func expectedValue(keyHash uint64, v tsm1.Value, k int, frac float64) (tsm1.Value, error) {
+	for ; k >= 0; k-- {
+		if IsDuplicate(keyHash, v.UnixNano(), k, frac) {
+			return DuplicateValue(v, k)
+		}
+	}
+	return v, nil
+}
+
+// IsDuplicate returns true if the value at time t of the key with the FNV-1a hash keyHash
+// is rewritten by duplicate generation k, such that approximately frac values are selected.
+func IsDuplicate(keyHash uint64, t int64, k int, frac float64) bool {
+	// splitmix64 finalizer
+	x := keyHash ^ uint64(t) ^ (uint64(k+1) * 0x9e3779b97f4a7c15)
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11)/(1<<53) < frac
+}
+
+// DuplicateValue returns the value written by duplicate generation k for v, which differs
+// from v. Numeric values are incremented by k+1, booleans are negated and strings have the
+// suffix "-dup<k>".
+func DuplicateValue(v tsm1.Value, k int) (tsm1.Value, error) {
+	switch x := v.Value().(type) {
+	case float64:
+		return tsm1.NewFloatValue(v.UnixNano(), x+float64(k+1)), nil
+	case int64:
+		return tsm1.NewIntegerValue(v.UnixNano(), x+int64(k+1)), nil
+	case uint64:
+		return tsm1.NewUnsignedValue(v.UnixNano(), x+uint64(k+1)), nil
+	case bool:
+		return tsm1.NewBooleanValue(v.UnixNano(), !x), nil
+	case string:
+		return tsm1.NewStringValue(v.UnixNano(), fmt.Sprintf("%s-dup%d", x, k)), nil
+	default:
+		return nil, fmt.Errorf("unexpected value type %T", x)
+	}
+}
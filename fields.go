@@ -0,0 +1,74 @@
+package ingen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/influxql"
+)
+
+// FieldsFileName is the name of the file within a shard directory persisting its
+// measurement field set, as written by influxd.
+const FieldsFileName = "fields.idx"
+
+// newFieldSet returns an empty field set to be saved in the shard directory dir.
+func newFieldSet(dir string) *tsdb.MeasurementFieldSet {
+	// the file does not exist yet, so loading cannot fail
+	fs, _ := tsdb.NewMeasurementFieldSet(filepath.Join(dir, FieldsFileName))
+	return fs
+}
+
+// saveFieldSet writes fs to the shard directory dir.
+func saveFieldSet(fs *tsdb.MeasurementFieldSet, dir string) error {
+	if fs.IsEmpty() {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return fs.Save()
+}
+
+// blockFieldType returns the field type of the values encoded in block.
+func blockFieldType(block []byte) (influxql.DataType, error) {
+	typ, err := tsm1.BlockType(block)
+	if err != nil {
+		return influxql.Unknown, err
+	}
+
+	switch typ {
+	case tsm1.BlockFloat64:
+		return influxql.Float, nil
+	case tsm1.BlockInteger:
+		return influxql.Integer, nil
+	case tsm1.BlockUnsigned:
+		return influxql.Unsigned, nil
+	case tsm1.BlockBoolean:
+		return influxql.Boolean, nil
+	case tsm1.BlockString:
+		return influxql.String, nil
+	default:
+		return influxql.Unknown, fmt.Errorf("unknown block type: %d", typ)
+	}
+}
+
+// valueFieldType returns the field type of v.
+func valueFieldType(v tsm1.Value) influxql.DataType {
+	switch v.Value().(type) {
+	case float64:
+		return influxql.Float
+	case int64:
+		return influxql.Integer
+	case uint64:
+		return influxql.Unsigned
+	case bool:
+		return influxql.Boolean
+	case string:
+		return influxql.String
+	default:
+		return influxql.Unknown
+	}
+}
@@ -0,0 +1,119 @@
+package ingen
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// generationWriter distributes the values of each key across several generations
+// of TSM files, as if each generation were a snapshot of the cache covering an
+// equal window of the shard's time range. Values within the final overlap of a
+// window alternate between the generation and the next, such that the time ranges
+// of adjacent generations overlap.
+type generationWriter struct {
+	ws      []blockWriter
+	bufs    []tsm1.Values
+	key     []byte
+	n       int // number of values written for key
+	start   int64
+	window  int64
+	overlap int64
+	size    int
+	vals    []tsm1.Value
+	err     error
+}
+
+func newGenerationWriter(ws []blockWriter, start, end time.Time, overlap float64, pointsPerBlock int) *generationWriter {
+	if pointsPerBlock == 0 {
+		pointsPerBlock = tsdb.DefaultMaxPointsPerBlock
+	}
+
+	window := end.Sub(start).Nanoseconds() / int64(len(ws))
+	return &generationWriter{
+		ws:      ws,
+		bufs:    make([]tsm1.Values, len(ws)),
+		start:   start.UnixNano(),
+		window:  window,
+		overlap: int64(float64(window) * overlap),
+		size:    pointsPerBlock,
+	}
+}
+
+func (w *generationWriter) Write(key []byte, values tsm1.Values) {
+	if !bytes.Equal(key, w.key) {
+		w.Flush()
+		w.key, w.n = key, 0
+	}
+
+	for _, v := range values {
+		k := w.generation(v.UnixNano())
+		w.n++
+
+		w.bufs[k] = append(w.bufs[k], v)
+		if len(w.bufs[k]) == w.size {
+			w.ws[k].Write(w.key, w.bufs[k])
+			w.bufs[k] = w.bufs[k][:0]
+		}
+	}
+}
+
+// WriteBlock decodes block, so its values may be distributed across generations.
+func (w *generationWriter) WriteBlock(key []byte, minTime, maxTime int64, block []byte) {
+	if w.err != nil {
+		return
+	}
+
+	var err error
+	w.vals, err = tsm1.DecodeBlock(block, w.vals[:0])
+	if err != nil {
+		w.err = fmt.Errorf("decoding block of %q: %v", key, err)
+		return
+	}
+	w.Write(key, w.vals)
+}
+
+// Flush writes the remaining values of the current key to each generation.
+func (w *generationWriter) Flush() {
+	for k := range w.bufs {
+		if len(w.bufs[k]) > 0 {
+			w.ws[k].Write(w.key, w.bufs[k])
+			w.bufs[k] = w.bufs[k][:0]
+		}
+	}
+}
+
+func (w *generationWriter) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	for _, bw := range w.ws {
+		if err := bw.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generation returns the index of the generation the value at time t is written to.
+func (w *generationWriter) generation(t int64) int {
+	last := len(w.ws) - 1
+
+	k := 0
+	if w.window > 0 {
+		k = int((t - w.start) / w.window)
+	}
+	if k < 0 {
+		k = 0
+	} else if k > last {
+		k = last
+	}
+
+	if k < last && t >= w.start+int64(k+1)*w.window-w.overlap && w.n%2 == 1 {
+		k++
+	}
+	return k
+}
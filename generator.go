@@ -2,17 +2,20 @@ package ingen
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
 	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+	"github.com/influxdata/influxql"
 )
 
 type SeriesGenerator interface {
@@ -27,71 +30,193 @@ type ValuesSequence interface {
 	Values() tsm1.Values
 }
 
+// EncodedBlock is a block of values encoded in the TSM block format.
+type EncodedBlock struct {
+	MinTime, MaxTime int64
+	Data             []byte
+}
+
+// EncodedValuesSequence is implemented by values sequences which produce identical
+// values for every series. The blocks are encoded once and written for each key.
+type EncodedValuesSequence interface {
+	// EncodedBlocks returns the encoded blocks of at most pointsPerBlock values.
+	// If pointsPerBlock is zero, blocks are as produced by the sequence.
+	EncodedBlocks(pointsPerBlock int) ([]EncodedBlock, error)
+}
+
+// SeriesGeneratorSplitter is implemented by series generators which can be divided
+// into n ordered, non-overlapping key ranges that may be generated concurrently.
+type SeriesGeneratorSplitter interface {
+	Split(n int) []SeriesGenerator
+}
+
 type Generator struct {
 	Concurrency int
 	BuildTSI    bool
 
+	// Limiter bounds the shards and key ranges written concurrently. It may be shared
+	// by Generators running concurrently. If nil, a Limiter of Concurrency is used.
+	Limiter *Limiter
+
+	// TSI specifies the partitioning and compaction of the TSI indexes built when BuildTSI is set.
+	TSI TSIConfig
+
+	// Splits is the number of key ranges each shard is divided into and written
+	// concurrently. Generators must implement SeriesGeneratorSplitter.
+	Splits int
+
+	// Encoders is the number of goroutines encoding blocks for each shard writer,
+	// leaving a single goroutine to write the encoded blocks. If zero, blocks are
+	// encoded by the goroutine writing the shard.
+	Encoders int
+
+	// MaxTSMFileSize is the size at which a new TSM file is started. If zero, defaults to 2GB.
+	MaxTSMFileSize uint32
+
+	// PointsPerBlock is the maximum number of values encoded in each block.
+	// If zero, blocks are written as produced by the values sequence.
+	PointsPerBlock int
+
+	// MaxBlocksPerKey is the number of blocks for a single key written to a TSM file before
+	// a new file is started. If zero, a file is limited only by the TSM index format.
+	MaxBlocksPerKey int
+
+	// Levels specifies the compaction level of each generation of TSM files written
+	// to a shard, in time order. Each generation covers an equal window of the shard.
+	// A level of 0, which must be last, writes the generation to the shard's WAL rather than TSM files.
+	// If empty, a shard is written as a single, fully compacted generation.
+	Levels []int
+
+	// Overlap is the fraction of each generation's window which overlaps the next.
+	Overlap float64
+
+	// WALPath is the directory containing the WAL directory of each shard written by Run,
+	// which is required when writing values to the WAL.
+	WALPath string
+
+	// WALLastShard writes the most recent shard entirely to the WAL.
+	WALLastShard bool
+
+	// Duplicates is the number of newer generations written to each shard which
+	// rewrite DuplicateFraction of the shard's points with a different value.
+	// The value of a point is that of the newest generation, per DuplicateValue.
+	// As the WAL takes precedence over TSM files, duplicates cannot be combined
+	// with a WAL generation or WALLastShard.
+	Duplicates        int
+	DuplicateFraction float64
+
+	// Deletes specifies series, or time ranges of series, which are deleted from
+	// every shard once generated, leaving tombstones in the TSM files, WAL and index.
+	Deletes []Delete
+
+	// Seed and Spec are recorded in the manifest written once generation completes.
+	Seed int64
+	Spec interface{}
+
 	sfile *tsdb.SeriesFile
+
+	mu        sync.Mutex
+	dropped   map[uint64]struct{}  // IDs of series dropped by deletes
+	anomalies []GroundTruthAnomaly // anomalies injected by an AnomalySequence; nil if none were generated
 }
 
+// RetentionPolicy describes the shard groups of a retention policy and the series
+// generator of each shard.
+type RetentionPolicy struct {
+	Name      string
+	ShardPath string // directory containing the directory of each shard
+	WALPath   string // directory containing the WAL directory of each shard
+	Groups    []meta.ShardGroupInfo
+
+	// Gens is the series generator of each shard, in order of Groups and their shards,
+	// and each generates the series of the entire shard group. When a shard group has
+	// more than one shard, each shard is written the series assigned to it by ShardIndex.
+	Gens []SeriesGenerator
+}
+
+// Run generates the shard groups of the retention policy directory shardPath, writing
+// the WAL of each shard to g.WALPath.
 func (g *Generator) Run(ctx context.Context, database, shardPath string, groups []meta.ShardGroupInfo, gens []SeriesGenerator) (err error) {
-	limit := make(chan struct{}, g.Concurrency)
-	for i := 0; i < g.Concurrency; i++ {
-		limit <- struct{}{}
+	rp := RetentionPolicy{
+		Name:      path.Base(shardPath),
+		ShardPath: shardPath,
+		WALPath:   g.WALPath,
+		Groups:    groups,
+		Gens:      gens,
+	}
+	return g.RunDatabase(ctx, database, path.Dir(shardPath), []RetentionPolicy{rp})
+}
+
+// RunDatabase generates the shard groups of each retention policy of the database
+// directory dbPath, which share the database's series file and manifest.
+func (g *Generator) RunDatabase(ctx context.Context, database, dbPath string, rps []RetentionPolicy) (err error) {
+	lim := g.limiter()
+
+	shardN := 0
+	for i := range rps {
+		for j := range rps[i].Groups {
+			shardN += len(rps[i].Groups[j].Shards)
+		}
 	}
 
 	var (
-		wg   sync.WaitGroup
-		errs ErrorList
-		ch   = make(chan error, len(groups))
+		wg    sync.WaitGroup
+		errs  ErrorList
+		ch    = make(chan error, shardN*3)
+		start = time.Now()
 	)
 
-	dbPath := path.Dir(shardPath)
 	g.sfile = tsdb.NewSeriesFile(filepath.Join(dbPath, tsdb.SeriesFileDirectory))
 	if err := g.sfile.Open(); err != nil {
 		return err
 	}
 	defer g.sfile.Close()
 	g.sfile.DisableCompactions()
-
-	wg.Add(len(groups))
-	for i := 0; i < len(groups); i++ {
-		go func(n int) {
-			<-limit
-			defer func() {
-				wg.Done()
-				limit <- struct{}{}
-			}()
-
-			id := groups[n].ID
-
-			var (
-				idx seriesIndex
-				ti  *tsi1.Index
-			)
-			if g.BuildTSI {
-				ti = tsi1.NewIndex(g.sfile, database, tsi1.WithPath(filepath.Join(shardPath, strconv.Itoa(int(id)), "index")))
-				if err := ti.Open(); err != nil {
-					ch <- fmt.Errorf("error opening TSI1 index %d: %s", id, err.Error())
-					return
-				}
-				idx = ti
-			} else {
-				idx = &seriesFileAdapter{sf: g.sfile, buf: make([]byte, 0, 2048)}
-			}
-
-			if err := g.writeShard(idx, gens[n], id, shardPath); err != nil {
-				ch <- fmt.Errorf("error writing shard %d: %s", id, err.Error())
-			}
-
-			if ti != nil {
-				ti.Compact()
-				ti.Wait()
-				if err := ti.Close(); err != nil {
-					ch <- fmt.Errorf("error compacting TSI1 index %d: %s", id, err.Error())
-				}
+	g.dropped = make(map[uint64]struct{})
+	g.anomalies = nil
+
+	wg.Add(shardN)
+	for i := range rps {
+		rp := &rps[i]
+		k := 0
+		for j := range rp.Groups {
+			sgi := &rp.Groups[j]
+			for n := range sgi.Shards {
+				go func(sgi *meta.ShardGroupInfo, last bool, id uint64, sg SeriesGenerator) {
+					<-lim.shards
+					defer func() {
+						wg.Done()
+						lim.shards <- struct{}{}
+					}()
+
+					var ti *tsi1.Index
+					if g.BuildTSI {
+						var err error
+						ti, err = g.openIndex(database, filepath.Join(rp.ShardPath, strconv.Itoa(int(id))))
+						if err != nil {
+							ch <- fmt.Errorf("error opening TSI1 index %d: %s", id, err.Error())
+							return
+						}
+					}
+
+					levels := g.Levels
+					if g.WALLastShard && last {
+						levels = []int{0}
+					}
+
+					if err := g.writeShard(lim.parts, ti, sg, sgi, id, rp.ShardPath, rp.WALPath, levels); err != nil {
+						ch <- fmt.Errorf("error writing shard %d: %s", id, err.Error())
+					}
+
+					if ti != nil {
+						if err := g.compactIndex(lim.parts, ti); err != nil {
+							ch <- fmt.Errorf("error compacting TSI1 index %d: %s", id, err.Error())
+						}
+					}
+				}(sgi, j == len(rp.Groups)-1, sgi.Shards[n].ID, NewShardSeriesGenerator(rp.Gens[k], len(sgi.Shards), n))
+				k++
 			}
-		}(i)
+		}
 	}
 	wg.Wait()
 
@@ -100,9 +225,42 @@ func (g *Generator) Run(ctx context.Context, database, shardPath string, groups
 		errs = append(errs, e)
 	}
 
-	parts := g.sfile.Partitions()
+	for id := range g.dropped {
+		if err := g.sfile.DeleteSeriesID(id); err != nil {
+			errs = append(errs, fmt.Errorf("error deleting series %d: %s", id, err.Error()))
+		}
+	}
+
+	errs = append(errs, g.compactSeriesFile(lim.parts)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if err := g.sfile.Close(); err != nil {
+		return err
+	}
+
+	if g.anomalies != nil {
+		if err := g.writeAnomalies(dbPath, rps); err != nil {
+			return err
+		}
+	}
+
+	return g.writeManifest(database, dbPath, rps, start)
+}
+
+// compactSeriesFile compacts each partition of the series file, acquiring a slot
+// from limit for each partition.
+func (g *Generator) compactSeriesFile(limit chan struct{}) ErrorList {
+	var (
+		wg    sync.WaitGroup
+		parts = g.sfile.Partitions()
+		ch    = make(chan error, len(parts))
+		errs  ErrorList
+	)
+
 	wg.Add(len(parts))
-	ch = make(chan error, len(parts))
 	for i := range parts {
 		go func(n int) {
 			<-limit
@@ -124,37 +282,253 @@ func (g *Generator) Run(ctx context.Context, database, shardPath string, groups
 	for e := range ch {
 		errs = append(errs, e)
 	}
+	return errs
+}
 
-	if len(errs) > 0 {
-		return errs
+// Limiter bounds the number of shards, and key ranges of shards, written concurrently.
+type Limiter struct {
+	shards chan struct{}
+	parts  chan struct{}
+}
+
+// NewLimiter returns a Limiter permitting n shards and n key ranges to be written concurrently.
+func NewLimiter(n int) *Limiter {
+	l := &Limiter{shards: make(chan struct{}, n), parts: make(chan struct{}, n)}
+	for i := 0; i < n; i++ {
+		l.shards <- struct{}{}
+		l.parts <- struct{}{}
 	}
+	return l
+}
 
-	return nil
+func (g *Generator) limiter() *Limiter {
+	if g.Limiter != nil {
+		return g.Limiter
+	}
+	return NewLimiter(g.Concurrency)
 }
 
 // seriesBatchSize specifies the number of series keys passed to the index.
 const seriesBatchSize = 1000
 
-func (g *Generator) writeShard(idx seriesIndex, sg SeriesGenerator, id uint64, path string) error {
-	sw := newShardWriter(id, path)
-	defer sw.Close()
+// writeShard writes the series from sg to the shard id of the shard group sgi, dividing
+// the key space into g.Splits ranges when sg implements SeriesGeneratorSplitter. Each
+// range acquires a slot from limit whilst writing.
+func (g *Generator) writeShard(limit chan struct{}, ti *tsi1.Index, sg SeriesGenerator, sgi *meta.ShardGroupInfo, id uint64, path, walPath string, levels []int) error {
+	parts := []SeriesGenerator{sg}
+	if s, ok := sg.(SeriesGeneratorSplitter); ok && g.Splits > 1 {
+		parts = s.Split(g.Splits)
+	}
+
+	if len(levels) == 0 {
+		levels = []int{1}
+	}
+	if g.Duplicates > 0 && levels[len(levels)-1] == 0 {
+		return errors.New("duplicates cannot be written to a shard with a WAL generation, which takes precedence over them")
+	}
+
+	// duplicates are written as newer, level 1 generations
+	gens := len(levels)
+	levels = append(levels[:gens:gens], make([]int, g.Duplicates)...)
+	for k := gens; k < len(levels); k++ {
+		levels[k] = 1
+	}
+
+	var wal *tsm1.WAL
+	for _, level := range levels {
+		if level != 0 || wal != nil {
+			continue
+		}
+		if walPath == "" {
+			return errors.New("WAL path required")
+		}
+		wal = tsm1.NewWAL(filepath.Join(walPath, strconv.Itoa(int(id))))
+		if err := wal.Open(); err != nil {
+			return err
+		}
+		defer wal.Close()
+	}
+
+	dir := filepath.Join(path, strconv.Itoa(int(id)))
+	fs := newFieldSet(dir)
 
+	var (
+		wg      sync.WaitGroup
+		writers = make([][]*shardWriter, len(levels))
+		errs    = make([]error, len(parts))
+		deletes = make([]*deleteSet, len(parts))
+	)
+
+	for k := range writers {
+		writers[k] = make([]*shardWriter, len(parts))
+	}
+
+	wg.Add(len(parts))
+	for i := range parts {
+		go func(n int) {
+			<-limit
+			defer func() {
+				wg.Done()
+				limit <- struct{}{}
+			}()
+
+			var idx seriesIndex
+			if ti != nil {
+				idx = ti
+			} else {
+				idx = &seriesFileAdapter{sf: g.sfile, buf: make([]byte, 0, 2048)}
+			}
+
+			if len(g.Deletes) > 0 {
+				deletes[n] = newDeleteSet(g.Deletes)
+			}
+
+			var (
+				bws   = make([]blockWriter, len(levels))
+				pipes []*blockPipeline
+				wals  []*walWriter
+			)
+			for k, level := range levels {
+				if level == 0 {
+					ww := newWALWriter(wal)
+					wals = append(wals, ww)
+					bws[k] = ww
+					continue
+				}
+
+				cfg := shardWriterConfig{
+					Generation:      k + 1,
+					Level:           level,
+					MaxFileSize:     g.MaxTSMFileSize,
+					MaxBlocksPerKey: g.MaxBlocksPerKey,
+				}
+
+				var sw *shardWriter
+				if len(parts) == 1 {
+					sw = newShardWriter(id, path, cfg)
+				} else {
+					sw = newShardPartWriter(id, path, n, cfg)
+				}
+				writers[k][n] = sw
+				bws[k] = sw
+
+				if g.Encoders > 0 {
+					p := newBlockPipeline(sw, g.Encoders)
+					pipes = append(pipes, p)
+					bws[k] = p
+				}
+			}
+
+			w := bws[0]
+			if gens > 1 {
+				w = newGenerationWriter(bws[:gens], sgi.StartTime, sgi.EndTime, g.Overlap, g.PointsPerBlock)
+			}
+			if len(bws) > gens {
+				w = newDuplicateWriter(w, bws[gens:], g.DuplicateFraction)
+			}
+
+			errs[n] = g.writeSeries(id, idx, parts[n], w, fs, deletes[n])
+			if f, ok := w.(interface{ Flush() }); ok {
+				f.Flush()
+			}
+
+			for _, ww := range wals {
+				ww.Flush()
+				if errs[n] == nil {
+					errs[n] = ww.Err()
+				}
+			}
+			for _, p := range pipes {
+				if err := p.Close(); errs[n] == nil {
+					errs[n] = err
+				}
+			}
+			for k := range writers {
+				sw := writers[k][n]
+				if sw == nil {
+					continue
+				}
+				sw.Close()
+				if errs[n] == nil {
+					errs[n] = sw.Err()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := NewErrorList(compactErrors(errs)); err != nil {
+		return err
+	}
+
+	if len(parts) > 1 {
+		for k := range writers {
+			if levels[k] == 0 {
+				continue
+			}
+			if err := renameShardParts(writers[k]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := saveFieldSet(fs, dir); err != nil {
+		return err
+	}
+
+	if len(g.Deletes) == 0 {
+		return nil
+	}
+	return g.applyDeletes(deletes, ti, wal, dir)
+}
+
+// applyDeletes writes tombstones for the keys of each part matching g.Deletes
+// and drops deleted series from the shard's index.
+func (g *Generator) applyDeletes(parts []*deleteSet, ti *tsi1.Index, wal *tsm1.WAL, dir string) error {
+	ds := parts[0]
+	for _, p := range parts[1:] {
+		ds.merge(p)
+	}
+
+	if err := ds.writeTombstones(dir, wal); err != nil {
+		return err
+	}
+
+	ids, err := ds.dropSeries(g.sfile, ti)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	for _, id := range ids {
+		g.dropped[id] = struct{}{}
+	}
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *Generator) writeSeries(id uint64, idx seriesIndex, sg SeriesGenerator, sw blockWriter, fs *tsdb.MeasurementFieldSet, ds *deleteSet) error {
 	var (
 		keys  [][]byte
 		names [][]byte
 		tags  []models.Tags
+		buf   tsm1.Values
 	)
 
 	for sg.Next() {
 		key := sg.Key()
 
-		seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey(key)
+		seriesKey, field := tsm1.SeriesAndFieldFromCompositeKey(key)
 		keys = append(keys, seriesKey)
 
 		name, tag := models.ParseKeyBytes(seriesKey)
 		names = append(names, name)
 		tags = append(tags, tag)
 
+		if ds != nil {
+			ds.add(key, seriesKey, name, tag)
+		}
+
 		if len(keys) == seriesBatchSize {
 			if err := idx.CreateSeriesListIfNotExists(keys, names, tags); err != nil {
 				return err
@@ -165,9 +539,60 @@ func (g *Generator) writeShard(idx seriesIndex, sg SeriesGenerator, id uint64, p
 		}
 
 		vg := sg.ValuesGenerator()
+		typ := influxql.Unknown
 
-		for vg.Next() {
-			sw.Write(key, vg.Values())
+		if ev, ok := vg.(EncodedValuesSequence); ok {
+			blocks, err := ev.EncodedBlocks(g.PointsPerBlock)
+			if err != nil {
+				return err
+			}
+			if len(blocks) > 0 {
+				if typ, err = blockFieldType(blocks[0].Data); err != nil {
+					return err
+				}
+			}
+			for i := range blocks {
+				sw.WriteBlock(key, blocks[i].MinTime, blocks[i].MaxTime, blocks[i].Data)
+			}
+		} else if n := g.PointsPerBlock; n > 0 {
+			// re-block values to contain at most n values
+			buf = buf[:0]
+			for vg.Next() {
+				vals := vg.Values()
+				if typ == influxql.Unknown && len(vals) > 0 {
+					typ = valueFieldType(vals[0])
+				}
+				if len(buf) == 0 && len(vals) == n {
+					sw.Write(key, vals)
+					continue
+				}
+				buf = append(buf, vals...)
+				for len(buf) >= n {
+					sw.Write(key, buf[:n])
+					buf = buf[:copy(buf, buf[n:])]
+				}
+			}
+			if len(buf) > 0 {
+				sw.Write(key, buf)
+			}
+		} else {
+			for vg.Next() {
+				vals := vg.Values()
+				if typ == influxql.Unknown && len(vals) > 0 {
+					typ = valueFieldType(vals[0])
+				}
+				sw.Write(key, vals)
+			}
+		}
+
+		if as, ok := vg.(AnomalySequence); ok {
+			g.recordAnomalies(id, seriesKey, field, as.Anomalies())
+		}
+
+		if typ != influxql.Unknown {
+			if err := fs.CreateFieldsIfNotExists(name).CreateFieldIfNotExists(field, typ); err != nil {
+				return fmt.Errorf("field %q of measurement %q: %v", field, name, err)
+			}
 		}
 
 		if err := sw.Err(); err != nil {
@@ -175,7 +600,7 @@ func (g *Generator) writeShard(idx seriesIndex, sg SeriesGenerator, id uint64, p
 		}
 	}
 
-	if len(keys) > seriesBatchSize {
+	if len(keys) > 0 {
 		if err := idx.CreateSeriesListIfNotExists(keys, names, tags); err != nil {
 			return err
 		}
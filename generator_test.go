@@ -0,0 +1,443 @@
+package ingen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+	"github.com/influxdata/ingen/pkg/gen"
+)
+
+var testStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestGroups returns n consecutive shard groups of 24h, each with a single shard of the same ID.
+func newTestGroups(n int) []meta.ShardGroupInfo {
+	groups := make([]meta.ShardGroupInfo, n)
+	for i := range groups {
+		id := uint64(i + 1)
+		groups[i] = meta.ShardGroupInfo{
+			ID:        id,
+			StartTime: testStart.Add(time.Duration(i) * 24 * time.Hour),
+			EndTime:   testStart.Add(time.Duration(i+1) * 24 * time.Hour),
+			Shards:    []meta.ShardInfo{{ID: id}},
+		}
+	}
+	return groups
+}
+
+// newTestSeries returns a generator of points random float values per series over the
+// shard group sgi, for each tag set of the tag cardinalities cards.
+func newTestSeries(sgi *meta.ShardGroupInfo, points int, cards ...int) ingen.SeriesGenerator {
+	vals := make([]gen.Sequence, len(cards))
+	for i, c := range cards {
+		vals[i] = gen.NewCounterByteSequenceCount(c)
+	}
+	tags := gen.NewTagsValuesSequenceValues("tag", vals)
+	delta := sgi.EndTime.Sub(sgi.StartTime) / time.Duration(points)
+	vg := gen.NewFloatRandomValuesSequence(points, sgi.StartTime, delta, 100, rand.New(rand.NewSource(int64(sgi.ID))))
+	return gen.NewSeriesGenerator([]byte("m0"), "v0", vg, tags)
+}
+
+// runTestGenerator generates groups into the retention policy directory rp of a new
+// database directory, using the series generator of each shard group returned by newSeries.
+// It returns the database directory.
+func runTestGenerator(t *testing.T, g *ingen.Generator, groups []meta.ShardGroupInfo, newSeries func(sgi *meta.ShardGroupInfo) ingen.SeriesGenerator) string {
+	t.Helper()
+	dbPath, err := ioutil.TempDir("", "ingen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dbPath) })
+
+	gens := make([]ingen.SeriesGenerator, len(groups))
+	for i := range groups {
+		if err := os.MkdirAll(shardDir(dbPath, groups[i].ID), 0777); err != nil {
+			t.Fatal(err)
+		}
+		gens[i] = newSeries(&groups[i])
+	}
+	if g.Concurrency == 0 {
+		g.Concurrency = 4
+	}
+	if err := g.Run(context.Background(), "db", filepath.Join(dbPath, "rp"), groups, gens); err != nil {
+		t.Fatal(err)
+	}
+	return dbPath
+}
+
+// shardDir returns the directory of the shard id of the retention policy rp of dbPath.
+func shardDir(dbPath string, id uint64) string {
+	return filepath.Join(dbPath, "rp", strconv.Itoa(int(id)))
+}
+
+// readSeries returns the values of each key of sg.
+func readSeries(sg ingen.SeriesGenerator) map[string]tsm1.Values {
+	res := make(map[string]tsm1.Values)
+	for sg.Next() {
+		var vals tsm1.Values
+		vg := sg.ValuesGenerator()
+		for vg.Next() {
+			for _, v := range vg.Values() {
+				vals = append(vals, tsm1.NewValue(v.UnixNano(), v.Value()))
+			}
+		}
+		res[string(sg.Key())] = vals
+	}
+	return res
+}
+
+// readShard returns the values of each key of the TSM files of the shard directory dir,
+// as read by tsm1, which merges the blocks of every generation and applies tombstones.
+func readShard(t *testing.T, dir string) map[string]tsm1.Values {
+	t.Helper()
+	fs := tsm1.NewFileStore(dir)
+	if err := fs.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	res := make(map[string]tsm1.Values)
+	for key, typ := range fs.Keys() {
+		c := fs.KeyCursor(context.Background(), []byte(key), models.MinNanoTime, true)
+		var vals tsm1.Values
+		for {
+			n := len(vals)
+			switch typ {
+			case tsm1.BlockFloat64:
+				var buf []tsm1.FloatValue
+				vs, err := c.ReadFloatBlock(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, v := range vs {
+					vals = append(vals, tsm1.NewFloatValue(v.UnixNano(), v.Value().(float64)))
+				}
+			case tsm1.BlockInteger:
+				var buf []tsm1.IntegerValue
+				vs, err := c.ReadIntegerBlock(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, v := range vs {
+					vals = append(vals, tsm1.NewIntegerValue(v.UnixNano(), v.Value().(int64)))
+				}
+			case tsm1.BlockBoolean:
+				var buf []tsm1.BooleanValue
+				vs, err := c.ReadBooleanBlock(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, v := range vs {
+					vals = append(vals, tsm1.NewBooleanValue(v.UnixNano(), v.Value().(bool)))
+				}
+			default:
+				t.Fatalf("%s: unexpected block type %d", key, typ)
+			}
+			if len(vals) == n {
+				break
+			}
+			c.Next()
+		}
+		c.Close()
+		if len(vals) > 0 {
+			res[key] = vals
+		}
+	}
+	return res
+}
+
+// checkTSMFiles checks that the keys of each TSM file of the shard directory dir are in
+// order, and that the values of each key of a file are in time order.
+func checkTSMFiles(t *testing.T, dir string) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.TSMFileExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := tsm1.NewTSMReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var prev []byte
+		for i := 0; i < r.KeyCount(); i++ {
+			key, _ := r.KeyAt(i)
+			if prev != nil && string(key) <= string(prev) {
+				t.Fatalf("%s: key %q follows %q", filepath.Base(name), key, prev)
+			}
+			prev = append(prev[:0], key...)
+
+			vals, err := r.ReadAll(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := 1; j < len(vals); j++ {
+				if vals[j].UnixNano() <= vals[j-1].UnixNano() {
+					t.Fatalf("%s: %s: value %d at %d follows %d", filepath.Base(name), key, j, vals[j].UnixNano(), vals[j-1].UnixNano())
+				}
+			}
+		}
+		r.Close()
+	}
+}
+
+// assertSeries checks that got has exactly the keys and values of want.
+func assertSeries(t *testing.T, got, want map[string]tsm1.Values) {
+	t.Helper()
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, expected %d", len(got), len(want))
+	}
+	for _, key := range keys {
+		vals, exp := got[key], want[key]
+		if len(vals) != len(exp) {
+			t.Fatalf("%s: got %d values, expected %d", key, len(vals), len(exp))
+		}
+		for i := range exp {
+			if vals[i].UnixNano() != exp[i].UnixNano() || vals[i].Value() != exp[i].Value() {
+				t.Fatalf("%s: value %d: got %v, expected %v", key, i, vals[i], exp[i])
+			}
+		}
+	}
+}
+
+func TestGenerator_Encoders(t *testing.T) {
+	groups := newTestGroups(2)
+	newSeries := func(sgi *meta.ShardGroupInfo) ingen.SeriesGenerator { return newTestSeries(sgi, 2500, 5, 7) }
+
+	for _, encoders := range []int{0, 1, 4} {
+		t.Run(strconv.Itoa(encoders), func(t *testing.T) {
+			dbPath := runTestGenerator(t, &ingen.Generator{Encoders: encoders}, groups, newSeries)
+			for i := range groups {
+				dir := shardDir(dbPath, groups[i].ID)
+				checkTSMFiles(t, dir)
+				assertSeries(t, readShard(t, dir), readSeries(newSeries(&groups[i])))
+			}
+		})
+	}
+}
+
+// readGenerations returns the values of each key of each generation of TSM files of
+// the shard directory dir, and the sequence of the first file of each generation.
+func readGenerations(t *testing.T, dir string) (map[int]map[string]tsm1.Values, map[int]int) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.TSMFileExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+
+	gens := make(map[int]map[string]tsm1.Values)
+	seqs := make(map[int]int)
+	for _, name := range files {
+		gen, seq, err := tsm1.ParseTSMFileName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gens[gen] == nil {
+			gens[gen] = make(map[string]tsm1.Values)
+			seqs[gen] = seq
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := tsm1.NewTSMReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < r.KeyCount(); i++ {
+			key, _ := r.KeyAt(i)
+			vals, err := r.ReadAll(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gens[gen][string(key)] = append(gens[gen][string(key)], vals...)
+		}
+		r.Close()
+	}
+	return gens, seqs
+}
+
+func TestGenerator_Levels(t *testing.T) {
+	groups := newTestGroups(1)
+	sgi := &groups[0]
+	newSeries := func(sgi *meta.ShardGroupInfo) ingen.SeriesGenerator { return newTestSeries(sgi, 1000, 4, 5) }
+	levels := []int{4, 2, 1}
+
+	for _, overlap := range []float64{0, 0.25} {
+		t.Run(strconv.FormatFloat(overlap, 'f', -1, 64), func(t *testing.T) {
+			g := &ingen.Generator{Levels: levels, Overlap: overlap, Encoders: 2, PointsPerBlock: 100}
+			dir := shardDir(runTestGenerator(t, g, groups, newSeries), sgi.ID)
+			checkTSMFiles(t, dir)
+
+			want := readSeries(newSeries(sgi))
+			assertSeries(t, readShard(t, dir), want)
+
+			gens, seqs := readGenerations(t, dir)
+			if len(gens) != len(levels) {
+				t.Fatalf("got %d generations, expected %d", len(gens), len(levels))
+			}
+
+			// each value is written to the generation of its window, or that of the next
+			// window when within the overlap at the end of its window
+			start := sgi.StartTime.UnixNano()
+			window := sgi.EndTime.Sub(sgi.StartTime).Nanoseconds() / int64(len(levels))
+			lap := int64(float64(window) * overlap)
+			n, lapped := 0, 0
+			for k, level := range levels {
+				vals := gens[k+1]
+				if seqs[k+1] != level {
+					t.Errorf("generation %d: first sequence %d, expected level %d", k+1, seqs[k+1], level)
+				}
+				min, max := start+int64(k)*window-lap, start+int64(k+1)*window
+				if k == 0 {
+					min = start
+				}
+				for key, vs := range vals {
+					n += len(vs)
+					for _, v := range vs {
+						ts := v.UnixNano()
+						if ts < min || ts >= max {
+							t.Fatalf("generation %d: %s: value at %d outside window [%d, %d)", k+1, key, ts, min, max)
+						}
+						if ts < start+int64(k)*window {
+							lapped++
+						}
+					}
+				}
+			}
+
+			exp := 0
+			for _, vals := range want {
+				exp += len(vals)
+			}
+			if n != exp {
+				t.Errorf("generations have %d values, expected %d", n, exp)
+			}
+			if overlap > 0 && lapped == 0 {
+				t.Errorf("no values written to the generation of the next window")
+			}
+		})
+	}
+}
+
+func TestGenerator_Deletes(t *testing.T) {
+	groups := newTestGroups(2)
+	newSeries := func(sgi *meta.ShardGroupInfo) ingen.SeriesGenerator { return newTestSeries(sgi, 500, 4, 5) }
+	deletes := []ingen.Delete{
+		{Tags: map[string]string{"tag0": "value1"}},
+		{Measurement: "m0", Tags: map[string]string{"tag1": "value2"}, Start: testStart.Add(6 * time.Hour), End: testStart.Add(30 * time.Hour)},
+		{Measurement: "m1"},
+	}
+
+	g := &ingen.Generator{Levels: []int{4, 2}, Splits: 1, Deletes: deletes}
+	dbPath := runTestGenerator(t, g, groups, newSeries)
+	for i := range groups {
+		dir := shardDir(dbPath, groups[i].ID)
+		if files, _ := filepath.Glob(filepath.Join(dir, "*.tombstone")); len(files) == 0 {
+			t.Errorf("shard %d: no tombstone files", groups[i].ID)
+		}
+
+		want := readSeries(newSeries(&groups[i]))
+		for key, vals := range want {
+			seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey([]byte(key))
+			name, tags := models.ParseKeyBytes(seriesKey)
+			for _, d := range deletes {
+				if !d.Matches(name, tags) {
+					continue
+				}
+				min, max := d.TimeRange()
+				var kept tsm1.Values
+				for _, v := range vals {
+					if ts := v.UnixNano(); ts < min || ts > max {
+						kept = append(kept, v)
+					}
+				}
+				vals = kept
+			}
+			if len(vals) == 0 {
+				delete(want, key)
+			} else {
+				want[key] = vals
+			}
+		}
+		assertSeries(t, readShard(t, dir), want)
+	}
+}
+
+func TestGenerator_Duplicates(t *testing.T) {
+	const (
+		dups = 3
+		frac = 0.3
+	)
+	tests := []struct {
+		name     string
+		overlap  float64
+		encoders int
+	}{
+		{name: "disjoint"},
+		{name: "overlapping", overlap: 0.25},
+		{name: "encoders", overlap: 0.25, encoders: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := newTestGroups(1)
+			sgi := &groups[0]
+			newSeries := func(sgi *meta.ShardGroupInfo) ingen.SeriesGenerator { return newTestSeries(sgi, 1000, 4, 5) }
+
+			g := &ingen.Generator{
+				Levels:            []int{4, 2},
+				Overlap:           tt.overlap,
+				Splits:            2,
+				Encoders:          tt.encoders,
+				PointsPerBlock:    100,
+				Duplicates:        dups,
+				DuplicateFraction: frac,
+			}
+			dir := shardDir(runTestGenerator(t, g, groups, newSeries), sgi.ID)
+			checkTSMFiles(t, dir)
+
+			// the values read are those of the newest generation rewriting each point
+			want := readSeries(newSeries(sgi))
+			changed := 0
+			for key, vals := range want {
+				for i, v := range vals {
+					exp, err := ingen.ExpectedValue([]byte(key), v, dups, frac)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if exp.Value() != v.Value() {
+						changed++
+					}
+					vals[i] = exp
+				}
+			}
+			if changed == 0 {
+				t.Fatal("no values were rewritten by the duplicate generations")
+			}
+			assertSeries(t, readShard(t, dir), want)
+		})
+	}
+}
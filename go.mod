@@ -1,17 +1,19 @@
 module github.com/influxdata/ingen
 
 require (
+	github.com/BurntSushi/toml v0.3.0
 	github.com/RoaringBitmap/roaring v0.4.3 // indirect
 	github.com/cespare/xxhash v1.0.0 // indirect
 	github.com/dgryski/go-bitstream v0.0.0-20160701042932-7d46cd22db70 // indirect
 	github.com/fsnotify/fsnotify v1.4.7 // indirect
 	github.com/glycerine/go-unsnap-stream v0.0.0-20171127062821-62a9a9eb44fd // indirect
 	github.com/gogo/protobuf v1.0.0 // indirect
+	github.com/golang/geo v0.0.0-20200319012246-673a6f80352d
 	github.com/golang/snappy v0.0.0-20160529050041-d9eb7a3d35ec // indirect
 	github.com/hashicorp/hcl v0.0.0-20180404174102-ef8a98b0bbce // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/influxdata/influxdb v0.0.0-20180321204609-aa61359cc74f
-	github.com/influxdata/influxql v0.0.0-20180313172256-53bc9c15f65b // indirect
+	github.com/influxdata/influxql v0.0.0-20180313172256-53bc9c15f65b
 	github.com/jsternberg/zap-logfmt v1.0.0 // indirect
 	github.com/jwilder/encoding v0.0.0-20170209172441-27894731927e // indirect
 	github.com/magiconair/properties v1.8.0 // indirect
@@ -0,0 +1,398 @@
+package ingen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+)
+
+// TSIConfig specifies the structure of the TSI indexes built by the Generator.
+type TSIConfig struct {
+	// PartitionN is the number of partitions of each index, which must be a power of 2.
+	// influxd must be started with the environment variable TSI_PARTITIONS set to the
+	// same value. If zero, defaults to tsi1.DefaultPartitionN.
+	PartitionN uint64
+
+	// MaxLogFileSize is the size at which a log file is compacted to a level 1 index file.
+	// If zero, defaults to tsi1.DefaultMaxLogFileSize.
+	MaxLogFileSize int64
+
+	// SkipCompaction leaves each partition with its active log file and the level 1 index
+	// files of previous log files, rather than compacting the index files to higher levels.
+	SkipCompaction bool
+}
+
+// Validate returns an error if c is invalid.
+func (c *TSIConfig) Validate() error {
+	if n := c.PartitionN; n&(n-1) != 0 {
+		return fmt.Errorf("TSI partitions must be a power of 2, got %d", n)
+	}
+	if c.MaxLogFileSize < 0 {
+		return fmt.Errorf("TSI max log file size must not be negative")
+	}
+	return nil
+}
+
+// openIndex opens the TSI index of the shard directory dir.
+func (g *Generator) openIndex(database, dir string) (*tsi1.Index, error) {
+	opts := []tsi1.IndexOption{tsi1.WithPath(filepath.Join(dir, "index"))}
+	if g.TSI.MaxLogFileSize > 0 {
+		opts = append(opts, tsi1.WithMaximumLogFileSize(g.TSI.MaxLogFileSize))
+	}
+
+	ti := tsi1.NewIndex(g.sfile, database, opts...)
+	if g.TSI.PartitionN > 0 {
+		ti.PartitionN = g.TSI.PartitionN
+	}
+	if err := ti.Open(); err != nil {
+		return nil, err
+	}
+	if g.TSI.SkipCompaction {
+		ti.DisableCompactions()
+	}
+	return ti, nil
+}
+
+// compactIndex compacts and closes ti, acquiring a slot from limit whilst compacting.
+// If g.TSI.SkipCompaction is set, only outstanding log file compactions are completed.
+func (g *Generator) compactIndex(limit chan struct{}, ti *tsi1.Index) error {
+	<-limit
+	defer func() { limit <- struct{}{} }()
+
+	if !g.TSI.SkipCompaction {
+		ti.Compact()
+	}
+	ti.Wait()
+	return ti.Close()
+}
+
+// IndexShard identifies a shard of a database for which a TSI index is built.
+type IndexShard struct {
+	RetentionPolicy string
+	ID              uint64
+	Path            string
+	WALPath         string // if empty, the shard has no WAL
+}
+
+// FindShards returns the shards of each retention policy of the database at dbPath,
+// ordered by retention policy and ID. If walPath is not empty, it is the WAL directory
+// of the database, containing the WAL directory of each shard.
+func FindShards(dbPath, walPath string) ([]IndexShard, error) {
+	rps, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var shards []IndexShard
+	for _, rp := range rps {
+		if !rp.IsDir() || rp.Name() == tsdb.SeriesFileDirectory {
+			continue
+		}
+
+		fis, err := ioutil.ReadDir(filepath.Join(dbPath, rp.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			id, err := strconv.ParseUint(fi.Name(), 10, 64)
+			if !fi.IsDir() || err != nil {
+				continue
+			}
+			sh := IndexShard{
+				RetentionPolicy: rp.Name(),
+				ID:              id,
+				Path:            filepath.Join(dbPath, rp.Name(), fi.Name()),
+			}
+			if walPath != "" {
+				sh.WALPath = filepath.Join(walPath, rp.Name(), fi.Name())
+			}
+			shards = append(shards, sh)
+		}
+	}
+
+	sort.Slice(shards, func(i, j int) bool {
+		if shards[i].RetentionPolicy != shards[j].RetentionPolicy {
+			return shards[i].RetentionPolicy < shards[j].RetentionPolicy
+		}
+		return shards[i].ID < shards[j].ID
+	})
+	return shards, nil
+}
+
+// BuildIndex builds the series file of the database at dbPath and a TSI index for
+// each of shards from the series keys of their TSM files and WAL segments, replacing
+// any existing TSI index. The indexes and series file are compacted as by Run. If the
+// database has a manifest, the checksums of the series file and indexes are updated to
+// those of the new files, whilst those of the TSM files and WAL segments are unchanged.
+func (g *Generator) BuildIndex(ctx context.Context, database, dbPath string, shards []IndexShard) error {
+	limit := g.limiter().parts
+
+	g.sfile = tsdb.NewSeriesFile(filepath.Join(dbPath, tsdb.SeriesFileDirectory))
+	if err := g.sfile.Open(); err != nil {
+		return err
+	}
+	defer g.sfile.Close()
+	g.sfile.DisableCompactions()
+
+	var (
+		wg   sync.WaitGroup
+		errs ErrorList
+		ch   = make(chan error, len(shards))
+	)
+
+	wg.Add(len(shards))
+	for i := range shards {
+		go func(sh *IndexShard) {
+			<-limit
+			defer wg.Done()
+
+			ti, err := g.buildShardIndex(ctx, database, sh)
+			limit <- struct{}{}
+			if err != nil {
+				ch <- fmt.Errorf("error indexing shard %d: %s", sh.ID, err.Error())
+				return
+			}
+
+			if err := g.compactIndex(limit, ti); err != nil {
+				ch <- fmt.Errorf("error compacting TSI1 index %d: %s", sh.ID, err.Error())
+			}
+		}(&shards[i])
+	}
+	wg.Wait()
+
+	close(ch)
+	for e := range ch {
+		errs = append(errs, e)
+	}
+
+	errs = append(errs, g.compactSeriesFile(limit)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if err := g.sfile.Close(); err != nil {
+		return err
+	}
+
+	m, err := ReadManifest(dbPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	dirs := []string{tsdb.SeriesFileDirectory}
+	for _, sh := range shards {
+		rel, err := filepath.Rel(dbPath, filepath.Join(sh.Path, "index"))
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, rel)
+	}
+	if err := m.ChecksumDirs(dbPath, dirs, g.Concurrency); err != nil {
+		return err
+	}
+	return m.Write(dbPath)
+}
+
+// buildShardIndex creates a new TSI index for the shard sh and adds the series of each
+// of its TSM files and of its WAL. The returned index is open.
+func (g *Generator) buildShardIndex(ctx context.Context, database string, sh *IndexShard) (*tsi1.Index, error) {
+	dir := sh.Path
+	if err := os.RemoveAll(filepath.Join(dir, "index")); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.TSMFileExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var segments []string
+	if sh.WALPath != "" {
+		pattern := fmt.Sprintf("%s*.%s", tsm1.WALFilePrefix, tsm1.WALFileExtension)
+		if segments, err = filepath.Glob(filepath.Join(sh.WALPath, pattern)); err != nil {
+			return nil, err
+		}
+		sort.Strings(segments)
+	}
+
+	ti, err := g.openIndex(database, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range files {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = indexTSMFile(ti, name); err != nil {
+			err = fmt.Errorf("%s: %v", filepath.Base(name), err)
+			break
+		}
+	}
+	if err == nil && len(segments) > 0 {
+		err = indexWAL(ctx, ti, segments)
+	}
+
+	if err != nil {
+		ti.Close()
+		return nil, err
+	}
+	return ti, nil
+}
+
+// indexTSMFile adds the series of each key of the TSM file name to ti.
+func indexTSMFile(ti *tsi1.Index, name string) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	r, err := tsm1.NewTSMReader(fd)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	defer r.Close()
+
+	var (
+		keys  [][]byte
+		names [][]byte
+		tags  []models.Tags
+		last  []byte
+	)
+
+	for i, n := 0, r.KeyCount(); i < n; i++ {
+		key, _ := r.KeyAt(i)
+		seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey(key)
+		if bytes.Equal(seriesKey, last) {
+			continue
+		}
+		last = seriesKey
+
+		name, tag := models.ParseKeyBytes(seriesKey)
+		keys = append(keys, seriesKey)
+		names = append(names, name)
+		tags = append(tags, tag)
+
+		if len(keys) == seriesBatchSize {
+			if err := ti.CreateSeriesListIfNotExists(keys, names, tags); err != nil {
+				return err
+			}
+			keys = keys[:0]
+			names = names[:0]
+			tags = tags[:0]
+		}
+	}
+
+	if len(keys) > 0 {
+		return ti.CreateSeriesListIfNotExists(keys, names, tags)
+	}
+	return nil
+}
+
+// indexWAL adds the series of each key remaining once the WAL segments are replayed
+// to ti, as the cache of influxd would hold them.
+func indexWAL(ctx context.Context, ti *tsi1.Index, segments []string) error {
+	live := make(map[string]struct{})
+	for _, name := range segments {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := replayWALSegment(name, live); err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(name), err)
+		}
+	}
+
+	keys := make([]string, 0, len(live))
+	for k := range live {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var (
+		series [][]byte
+		names  [][]byte
+		tags   []models.Tags
+		last   []byte
+	)
+	for _, k := range keys {
+		seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey([]byte(k))
+		if bytes.Equal(seriesKey, last) {
+			continue
+		}
+		last = seriesKey
+
+		name, tag := models.ParseKeyBytes(seriesKey)
+		series = append(series, seriesKey)
+		names = append(names, name)
+		tags = append(tags, tag)
+
+		if len(series) == seriesBatchSize {
+			if err := ti.CreateSeriesListIfNotExists(series, names, tags); err != nil {
+				return err
+			}
+			series = series[:0]
+			names = names[:0]
+			tags = tags[:0]
+		}
+	}
+
+	if len(series) > 0 {
+		return ti.CreateSeriesListIfNotExists(series, names, tags)
+	}
+	return nil
+}
+
+// replayWALSegment applies the entries of the WAL segment name to live, the set of keys
+// with values. Keys are removed by deletes of their entire time range.
+func replayWALSegment(name string, live map[string]struct{}) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	r := tsm1.NewWALSegmentReader(fd)
+	defer r.Close()
+
+	for r.Next() {
+		entry, err := r.Read()
+		if err != nil {
+			return err
+		}
+
+		switch e := entry.(type) {
+		case *tsm1.WriteWALEntry:
+			for k := range e.Values {
+				live[k] = struct{}{}
+			}
+		case *tsm1.DeleteWALEntry:
+			for _, k := range e.Keys {
+				delete(live, string(k))
+			}
+		case *tsm1.DeleteRangeWALEntry:
+			if e.Min != math.MinInt64 || e.Max != math.MaxInt64 {
+				continue
+			}
+			for _, k := range e.Keys {
+				delete(live, string(k))
+			}
+		}
+	}
+	return r.Error()
+}
@@ -0,0 +1,72 @@
+package ingen_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/ingen"
+)
+
+func TestGenerator_BuildIndex(t *testing.T) {
+	groups := newTestGroups(2)
+	newSeries := func(sgi *meta.ShardGroupInfo) ingen.SeriesGenerator { return newTestSeries(sgi, 100, 4, 5) }
+	dbPath := runTestGenerator(t, &ingen.Generator{BuildTSI: true}, groups, newSeries)
+
+	shards, err := ingen.FindShards(dbPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) != len(groups) {
+		t.Fatalf("found %d shards, expected %d", len(shards), len(groups))
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		g := &ingen.Generator{Concurrency: 4}
+		if err := g.BuildIndex(context.Background(), "db", dbPath, shards); err != nil {
+			t.Fatal(err)
+		}
+		m, err := ingen.ReadManifest(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Verify(dbPath, "", 4); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+	})
+
+	t.Run("corrupt TSM file", func(t *testing.T) {
+		files, err := filepath.Glob(filepath.Join(shardDir(dbPath, groups[0].ID), "*.tsm"))
+		if err != nil || len(files) == 0 {
+			t.Fatalf("no TSM files: %v", err)
+		}
+		f, err := os.OpenFile(files[0], os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a byte of the first block, after the header and block checksum
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, 10); err != nil {
+			t.Fatal(err)
+		}
+		b[0] ^= 0xff
+		if _, err := f.WriteAt(b, 10); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		g := &ingen.Generator{Concurrency: 4}
+		if err := g.BuildIndex(context.Background(), "db", dbPath, shards); err != nil {
+			t.Fatal(err)
+		}
+		m, err := ingen.ReadManifest(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Verify(dbPath, "", 4); err == nil {
+			t.Fatal("expected the corrupt TSM file to fail verification")
+		}
+	})
+}
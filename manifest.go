@@ -0,0 +1,302 @@
+package ingen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestFileName is the name of the manifest file written to the database directory.
+const ManifestFileName = "ingen-manifest.json"
+
+// Version is the ingen version recorded in the manifest. It is set at build time.
+var Version = "dev"
+
+// Manifest records how a generated dataset was produced and the checksums
+// of every file written, so it can be re-verified at a later time.
+type Manifest struct {
+	Version   string          `json:"version"`
+	Database  string          `json:"database"`
+	Seed      int64           `json:"seed"`
+	Spec      interface{}     `json:"spec,omitempty"`
+	StartTime time.Time       `json:"start_time"`
+	EndTime   time.Time       `json:"end_time"`
+	Elapsed   string          `json:"elapsed"`
+	Shards    []ManifestShard `json:"shards"`
+	Files     []ManifestFile  `json:"files"`
+
+	// WALPath is the WAL directory of the database, containing the WAL directory of
+	// each shard of each retention policy, and WALFiles are the files within it.
+	WALPath  string         `json:"wal_path,omitempty"`
+	WALFiles []ManifestFile `json:"wal_files,omitempty"`
+}
+
+// ManifestShard describes a generated shard and the time range it covers.
+type ManifestShard struct {
+	ID              uint64    `json:"id"`
+	ShardGroupID    uint64    `json:"shard_group_id"`
+	RetentionPolicy string    `json:"retention_policy"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+}
+
+// ManifestFile describes a single file, relative to the database or WAL directory.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ReadManifest reads the manifest from the database directory dbPath.
+func ReadManifest(dbPath string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dbPath, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Manifest)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("error decoding manifest: %s", err.Error())
+	}
+	return m, nil
+}
+
+// Write writes the manifest to the database directory dbPath.
+func (m *Manifest) Write(dbPath string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dbPath, ManifestFileName), b, 0666)
+}
+
+// Verify recomputes the checksum of every file in the manifest, relative to dbPath or,
+// for WAL files, to walPath, defaulting to m.WALPath if empty. It returns an ErrorList
+// describing each missing or modified file.
+func (m *Manifest) Verify(dbPath, walPath string, concurrency int) error {
+	if walPath == "" {
+		walPath = m.WALPath
+	}
+
+	el := verifyFiles(dbPath, m.Files, concurrency)
+	if len(m.WALFiles) > 0 {
+		el = append(el, verifyFiles(walPath, m.WALFiles, concurrency)...)
+	}
+
+	if len(el) > 0 {
+		return el
+	}
+	return nil
+}
+
+func verifyFiles(dir string, files []ManifestFile, concurrency int) ErrorList {
+	sums := make([]ManifestFile, len(files))
+	errs := make([]error, len(files))
+	forEach(len(files), concurrency, func(i int) {
+		sums[i], errs[i] = checksumFile(dir, files[i].Path)
+	})
+
+	var el ErrorList
+	for i := range files {
+		want, got := &files[i], &sums[i]
+		switch {
+		case errs[i] != nil:
+			el = append(el, errs[i])
+		case got.Size != want.Size:
+			el = append(el, fmt.Errorf("%s: size mismatch: expected %d, got %d", want.Path, want.Size, got.Size))
+		case got.SHA256 != want.SHA256:
+			el = append(el, fmt.Errorf("%s: checksum mismatch: expected %s, got %s", want.Path, want.SHA256, got.SHA256))
+		}
+	}
+	return el
+}
+
+// ChecksumFiles records the size and checksum of every file of the database directory
+// dbPath, other than the manifest, and of the WAL directory m.WALPath, if set.
+func (m *Manifest) ChecksumFiles(dbPath string, concurrency int) (err error) {
+	if m.Files, err = checksumDir(dbPath, concurrency); err != nil {
+		return err
+	}
+	m.WALFiles = nil
+	if m.WALPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(m.WALPath); os.IsNotExist(err) {
+		return nil
+	}
+	m.WALFiles, err = checksumDir(m.WALPath, concurrency)
+	return err
+}
+
+// ChecksumDirs replaces the entries of the files within each of dirs, relative to the
+// database directory dbPath, by the size and checksum of the files they now contain. The
+// entries of all other files are left unchanged.
+func (m *Manifest) ChecksumDirs(dbPath string, dirs []string, concurrency int) error {
+	within := func(p string) bool {
+		for _, dir := range dirs {
+			if strings.HasPrefix(p, filepath.ToSlash(dir)+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var files []ManifestFile
+	for _, f := range m.Files {
+		if !within(f.Path) {
+			files = append(files, f)
+		}
+	}
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dbPath, dir)); os.IsNotExist(err) {
+			continue
+		}
+		sums, err := checksumDir(filepath.Join(dbPath, dir), concurrency)
+		if err != nil {
+			return err
+		}
+		for _, f := range sums {
+			f.Path = path.Join(filepath.ToSlash(dir), f.Path)
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	m.Files = files
+	return nil
+}
+
+func (g *Generator) writeManifest(database, dbPath string, rps []RetentionPolicy, start time.Time) error {
+	m := &Manifest{
+		Version:   Version,
+		Database:  database,
+		Seed:      g.Seed,
+		Spec:      g.Spec,
+		StartTime: start.UTC(),
+		EndTime:   time.Now().UTC(),
+	}
+	m.Elapsed = m.EndTime.Sub(m.StartTime).String()
+
+	for _, rp := range rps {
+		for i := range rp.Groups {
+			sgi := &rp.Groups[i]
+			for _, sh := range sgi.Shards {
+				m.Shards = append(m.Shards, ManifestShard{
+					ID:              sh.ID,
+					ShardGroupID:    sgi.ID,
+					RetentionPolicy: rp.Name,
+					StartTime:       sgi.StartTime.UTC(),
+					EndTime:         sgi.EndTime.UTC(),
+				})
+			}
+		}
+	}
+
+	// the WAL directory of each retention policy is within that of the database
+	if len(rps) > 0 && rps[0].WALPath != "" {
+		walPath, err := filepath.Abs(filepath.Dir(rps[0].WALPath))
+		if err != nil {
+			return err
+		}
+		m.WALPath = walPath
+	}
+
+	if err := m.ChecksumFiles(dbPath, g.Concurrency); err != nil {
+		return err
+	}
+	return m.Write(dbPath)
+}
+
+// checksumDir returns the size and checksum of every file in dir, other than a manifest,
+// in path order.
+func checksumDir(dir string, concurrency int) ([]ManifestFile, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel != ManifestFileName {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	files := make([]ManifestFile, len(paths))
+	errs := make([]error, len(paths))
+	forEach(len(paths), concurrency, func(i int) {
+		files[i], errs[i] = checksumFile(dir, paths[i])
+	})
+	if err := NewErrorList(compactErrors(errs)); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func checksumFile(dir, rel string) (ManifestFile, error) {
+	f, err := os.Open(filepath.Join(dir, rel))
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("%s: %s", rel, err.Error())
+	}
+	return ManifestFile{Path: filepath.ToSlash(rel), Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// forEach calls fn for each index in [0, n), running at most concurrency calls at once.
+func forEach(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, concurrency)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		limit <- struct{}{}
+		go func(i int) {
+			defer func() {
+				wg.Done()
+				<-limit
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func compactErrors(errs []error) []error {
+	var res []error
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
@@ -0,0 +1,143 @@
+package ingen
+
+import (
+	"sync"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// blockWriter writes blocks of values for a key, in key order.
+type blockWriter interface {
+	Write(key []byte, values tsm1.Values)
+	WriteBlock(key []byte, minTime, maxTime int64, block []byte)
+	Err() error
+}
+
+type encodedBlock struct {
+	key      []byte
+	values   tsm1.Values
+	block    []byte
+	raw      []byte // pre-encoded block, which is not owned by the pipeline
+	min, max int64
+	err      error
+	done     chan struct{}
+}
+
+// blockPipeline encodes blocks using a pool of goroutines and writes the
+// encoded blocks in order to a shardWriter from a single goroutine.
+// The number of blocks in flight is bounded by the size of the pipeline.
+type blockPipeline struct {
+	sw    *shardWriter
+	work  chan *encodedBlock
+	order chan *encodedBlock
+	free  chan *encodedBlock
+	wg    sync.WaitGroup
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newBlockPipeline(sw *shardWriter, workers int) *blockPipeline {
+	size := 4 * workers
+	p := &blockPipeline{
+		sw:    sw,
+		work:  make(chan *encodedBlock, size),
+		order: make(chan *encodedBlock, size),
+		free:  make(chan *encodedBlock, size+1),
+		done:  make(chan struct{}),
+	}
+
+	for i := 0; i < cap(p.free); i++ {
+		p.free <- &encodedBlock{
+			values: make(tsm1.Values, 0, tsdb.DefaultMaxPointsPerBlock),
+			done:   make(chan struct{}, 1),
+		}
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.encode()
+	}
+	go p.write()
+
+	return p
+}
+
+// Write copies values and schedules the block to be encoded. Write blocks
+// if the number of blocks in flight reaches the size of the pipeline.
+func (p *blockPipeline) Write(key []byte, values tsm1.Values) {
+	if len(values) == 0 {
+		return
+	}
+
+	b := <-p.free
+	b.key = key
+	b.values = append(b.values[:0], values...)
+	p.order <- b
+	p.work <- b
+}
+
+// WriteBlock schedules a block which has already been encoded to be written in order.
+func (p *blockPipeline) WriteBlock(key []byte, minTime, maxTime int64, block []byte) {
+	b := <-p.free
+	b.key, b.raw = key, block
+	b.min, b.max = minTime, maxTime
+	b.err = nil
+	b.done <- struct{}{}
+	p.order <- b
+}
+
+// Close waits for all pending blocks to be written.
+func (p *blockPipeline) Close() error {
+	close(p.work)
+	close(p.order)
+	p.wg.Wait()
+	<-p.done
+	return p.Err()
+}
+
+func (p *blockPipeline) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *blockPipeline) setErr(err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+}
+
+func (p *blockPipeline) encode() {
+	defer p.wg.Done()
+	for b := range p.work {
+		b.min, b.max = b.values[0].UnixNano(), b.values[len(b.values)-1].UnixNano()
+		b.block, b.err = b.values.Encode(b.block[:0])
+		b.done <- struct{}{}
+	}
+}
+
+func (p *blockPipeline) write() {
+	defer close(p.done)
+	for b := range p.order {
+		<-b.done
+		if b.err != nil {
+			p.setErr(b.err)
+		} else if p.Err() == nil {
+			block := b.block
+			if b.raw != nil {
+				block = b.raw
+			}
+			p.sw.WriteBlock(b.key, b.min, b.max, block)
+			if err := p.sw.Err(); err != nil {
+				p.setErr(err)
+			}
+		}
+		b.key, b.raw = nil, nil
+		p.free <- b
+	}
+}
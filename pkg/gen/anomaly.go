@@ -0,0 +1,226 @@
+package gen
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// AnomalyConfig specifies the anomalies injected by an AnomalyValuesSequence.
+type AnomalyConfig struct {
+	// Rates is the probability of each anomaly type, keyed by type, occurring in a series.
+	Rates map[string]float64
+
+	// Magnitude is the amount by which spikes, drops and level shifts change values.
+	Magnitude float64
+
+	// Duration is the duration of the window of level shifts, flatlines and missing values.
+	Duration time.Duration
+}
+
+// anomalyTypes orders the anomaly types drawn on each Reset, so that sequences are reproducible.
+var anomalyTypes = []string{ingen.AnomalySpike, ingen.AnomalyDrop, ingen.AnomalyLevelShift, ingen.AnomalyFlatline, ingen.AnomalyMissing}
+
+// IsAnomalyType reports whether typ is a type of anomaly injected by an AnomalyValuesSequence.
+func IsAnomalyType(typ string) bool {
+	for _, t := range anomalyTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+type anomalyWindow struct {
+	typ        string
+	start, end int64 // spikes and drops affect the first value at or after start
+	affected   ingen.Anomaly
+	flat       tsm1.Value
+}
+
+// AnomalyValuesSequence injects anomalies into the values of a sequence. On each Reset, each
+// type of anomaly occurs with the probability of its rate, at a random time within the time
+// range of the shard. Anomalies of integer and float values are injected; spikes, drops and level
+// shifts of values of other types are ignored. The anomalies of the values produced are
+// returned by Anomalies.
+type AnomalyValuesSequence struct {
+	vs      ingen.ValuesSequence
+	r       *rand.Rand
+	seed    int64 // seed of the source of each series, with its key
+	cfg     AnomalyConfig
+	start   int64
+	end     int64
+	windows []anomalyWindow
+	buf     tsm1.Values
+	vals    tsm1.Values
+	res     []ingen.Anomaly
+}
+
+// NewAnomalyValuesSequence returns a sequence of the values of vs, over the time range
+// [start, end), with anomalies injected per cfg.
+func NewAnomalyValuesSequence(vs ingen.ValuesSequence, start, end time.Time, cfg AnomalyConfig, r *rand.Rand) *AnomalyValuesSequence {
+	g := &AnomalyValuesSequence{
+		vs:    vs,
+		r:     r,
+		seed:  r.Int63(),
+		cfg:   cfg,
+		start: start.UnixNano(),
+		end:   end.UnixNano(),
+		buf:   make(tsm1.Values, 0, tsdb.DefaultMaxPointsPerBlock),
+	}
+	g.Reset()
+	return g
+}
+
+// SeedSeries seeds the source of the anomalies of the series key, and that of the underlying sequence.
+func (g *AnomalyValuesSequence) SeedSeries(key []byte) {
+	g.r.Seed(g.seed ^ keyHash(key))
+	if s, ok := g.vs.(SeriesSeeder); ok {
+		s.SeedSeries(key)
+	}
+}
+
+func (g *AnomalyValuesSequence) Reset() {
+	g.vs.Reset()
+	g.windows = g.windows[:0]
+
+	span := g.end - g.start
+	for _, typ := range anomalyTypes {
+		if g.r.Float64() >= g.cfg.Rates[typ] {
+			continue
+		}
+
+		w := anomalyWindow{typ: typ}
+		switch typ {
+		case ingen.AnomalySpike, ingen.AnomalyDrop:
+			w.start = g.start + g.r.Int63n(span)
+			w.end = w.start
+		default:
+			d := int64(g.cfg.Duration)
+			if d > span {
+				d = span
+			}
+			w.start = g.start + g.r.Int63n(span-d+1)
+			w.end = w.start + d
+		}
+		g.windows = append(g.windows, w)
+	}
+}
+
+func (g *AnomalyValuesSequence) Next() bool {
+	for g.vs.Next() {
+		vals := g.vs.Values()
+		if len(g.windows) == 0 {
+			g.vals = vals
+			return true
+		}
+
+		g.buf = g.buf[:0]
+		for _, v := range vals {
+			if v, ok := g.inject(v); ok {
+				g.buf = append(g.buf, v)
+			}
+		}
+		if len(g.buf) > 0 {
+			g.vals = g.buf
+			return true
+		}
+	}
+	return false
+}
+
+// inject applies the anomalies of the current series to v, returning false if v is removed.
+func (g *AnomalyValuesSequence) inject(v tsm1.Value) (tsm1.Value, bool) {
+	ts := v.UnixNano()
+
+	// a missing value is not affected by other anomalies
+	for i := range g.windows {
+		if w := &g.windows[i]; w.typ == ingen.AnomalyMissing && ts >= w.start && ts < w.end {
+			w.affect(ts)
+			return nil, false
+		}
+	}
+
+	for i := range g.windows {
+		w := &g.windows[i]
+
+		var ok bool
+		switch w.typ {
+		case ingen.AnomalySpike, ingen.AnomalyDrop:
+			if ts >= w.start && w.affected.Type == "" {
+				m := g.cfg.Magnitude
+				if w.typ == ingen.AnomalyDrop {
+					m = -m
+				}
+				v, ok = addValue(v, m)
+			}
+		case ingen.AnomalyLevelShift:
+			if ts >= w.start && ts < w.end {
+				v, ok = addValue(v, g.cfg.Magnitude)
+			}
+		case ingen.AnomalyFlatline:
+			if ts >= w.start && ts < w.end {
+				if w.flat == nil {
+					w.flat = v
+				}
+				v, ok = tsm1.NewValue(ts, w.flat.Value()), true
+			}
+		}
+
+		if ok {
+			w.affect(ts)
+		}
+	}
+	return v, true
+}
+
+// affect records the value at time ts as affected by the anomaly of w.
+func (w *anomalyWindow) affect(ts int64) {
+	if w.affected.Type == "" {
+		w.affected = ingen.Anomaly{Type: w.typ, Start: ts}
+	}
+	w.affected.End = ts
+}
+
+// addValue returns v increased by m, if v is an integer or float value.
+func addValue(v tsm1.Value, m float64) (tsm1.Value, bool) {
+	switch x := v.Value().(type) {
+	case float64:
+		return tsm1.NewFloatValue(v.UnixNano(), x+m), true
+	case int64:
+		return tsm1.NewIntegerValue(v.UnixNano(), x+int64(m)), true
+	}
+	return v, false
+}
+
+func (g *AnomalyValuesSequence) Values() tsm1.Values { return g.vals }
+
+// Anomalies returns the anomalies injected into the values produced since the last call to Reset.
+func (g *AnomalyValuesSequence) Anomalies() []ingen.Anomaly {
+	g.res = g.res[:0]
+	for i := range g.windows {
+		if a := g.windows[i].affected; a.Type != "" {
+			g.res = append(g.res, a)
+		}
+	}
+	return g.res
+}
+
+// Clone returns a copy of g, cloning the underlying sequence, which must implement Clone,
+// with a new source which draws the same anomalies for each series seeded by SeedSeries.
+func (g *AnomalyValuesSequence) Clone() ingen.ValuesSequence {
+	c := &AnomalyValuesSequence{
+		vs:    g.vs.(interface{ Clone() ingen.ValuesSequence }).Clone(),
+		r:     rand.New(rand.NewSource(g.seed)),
+		seed:  g.seed,
+		cfg:   g.cfg,
+		start: g.start,
+		end:   g.end,
+		buf:   make(tsm1.Values, 0, tsdb.DefaultMaxPointsPerBlock),
+	}
+	c.Reset()
+	return c
+}
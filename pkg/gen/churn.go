@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"strconv"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+// ChurnTagsSequence models series churn, such as ephemeral container IDs, by replacing
+// series of a TagsSequence with new series. The tag sets of the sequence are replaced in
+// order, cyclically, so that once replaced series have been replaced, the first tag set is
+// replaced again. The value of the last tag of a replaced tag set is suffixed by the number
+// of times it has been replaced, which keeps the keys of the sequence ordered.
+type ChurnTagsSequence struct {
+	tags     TagsSequence
+	replaced int // number of tag sets replaced, in total
+	count    int
+	n        int // index of the current tag set
+	buf      models.Tags
+	val      []byte
+}
+
+// NewChurnTagsSequence returns a sequence of the tag sets of tags after replaced tag sets
+// have been replaced. Generating a shard group with replaced increasing in proportion to the
+// shard group's index replaces the same fraction of series in each shard group.
+func NewChurnTagsSequence(tags TagsSequence, replaced int) *ChurnTagsSequence {
+	return &ChurnTagsSequence{tags: tags, replaced: replaced, count: tags.Count(), n: -1}
+}
+
+func (s *ChurnTagsSequence) Next() bool {
+	if !s.tags.Next() {
+		return false
+	}
+	s.n++
+
+	tags := s.tags.Value()
+	s.buf = append(s.buf[:0], tags...)
+	if g := s.generation(); g > 0 && len(s.buf) > 0 {
+		last := &s.buf[len(s.buf)-1]
+		s.val = append(append(s.val[:0], last.Value...), '-')
+		s.val = strconv.AppendInt(s.val, int64(g), 10)
+		last.Value = s.val
+	}
+	return true
+}
+
+// generation returns the number of times the current tag set has been replaced.
+func (s *ChurnTagsSequence) generation() int {
+	return (s.replaced - s.n + s.count - 1) / s.count
+}
+
+func (s *ChurnTagsSequence) Value() models.Tags { return s.buf }
+func (s *ChurnTagsSequence) Count() int         { return s.tags.Count() }
+
+// Split divides the tag sets into at most n ordered, non-overlapping sequences, if the
+// underlying sequence may be split. Split must be called before the first call to Next.
+func (s *ChurnTagsSequence) Split(n int) []TagsSequence {
+	ts, ok := s.tags.(interface{ Split(n int) []TagsSequence })
+	if !ok {
+		return []TagsSequence{s}
+	}
+
+	parts := ts.Split(n)
+	res := make([]TagsSequence, len(parts))
+	start := s.n
+	for i := range parts {
+		res[i] = &ChurnTagsSequence{tags: parts[i], replaced: s.replaced, count: s.count, n: start}
+		start += parts[i].Count()
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package gen
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// readKeys returns the key of each series of g.
+func readKeys(g ingen.SeriesGenerator) []string {
+	var keys []string
+	for g.Next() {
+		keys = append(keys, string(g.Key()))
+	}
+	return keys
+}
+
+// shardKeys returns the keys assigned to shard i of a shard group of n shards.
+func shardKeys(keys []string, n, i int) []string {
+	var res []string
+	for _, key := range keys {
+		seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey([]byte(key))
+		if ingen.ShardIndex(seriesKey, n) == i {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+func TestChurnTagsSequence_Order(t *testing.T) {
+	const shards = 3
+	cards := []int{3, 12}
+	count := 3 * 12
+
+	newSeries := func(replaced int) *SeriesGenerator {
+		tags := NewChurnTagsSequence(newTestTagsSequence(cards...), replaced)
+		vg := NewIntegerConstantValuesSequence(1, time.Unix(0, 0), time.Hour, 1)
+		return NewSeriesGenerator([]byte("m0"), "v0", vg, tags)
+	}
+
+	base := readKeys(newSeries(0))
+	for _, replaced := range []int{0, 1, count / 3, count - 1, count, count + 5, 2*count + 7, 11 * count} {
+		t.Run(fmt.Sprintf("replaced=%d", replaced), func(t *testing.T) {
+			all := readKeys(newSeries(replaced))
+			if len(all) != count {
+				t.Fatalf("got %d series, expected %d", len(all), count)
+			}
+			changed := 0
+			for i := range all {
+				if all[i] != base[i] {
+					changed++
+				}
+			}
+			if exp := min(replaced, count); changed != exp {
+				t.Errorf("%d series were replaced, expected %d", changed, exp)
+			}
+
+			// each shard is written its series in key order, and may be split into parts
+			// written by several goroutines
+			for i := 0; i < shards; i++ {
+				keys := shardKeys(all, shards, i)
+				for j := 1; j < len(keys); j++ {
+					if keys[j] <= keys[j-1] {
+						t.Fatalf("shard %d: key %q does not follow %q", i, keys[j], keys[j-1])
+					}
+				}
+
+				var got []string
+				for _, p := range newSeries(replaced).Split(4) {
+					got = append(got, shardKeys(readKeys(p), shards, i)...)
+				}
+				assertKeys(t, got, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package gen
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// FieldsModel generates the values of the fields of each point of a series, such that
+// the values are related.
+type FieldsModel interface {
+	// Fields returns the names of the fields.
+	Fields() []string
+
+	// Reset starts a new series, drawing random values from r. The hash of the series
+	// key, series, is the same in every shard, so models whose values continue across
+	// shards, such as counters, may derive their state from it.
+	Reset(r *rand.Rand, series int64)
+
+	// Next sets vals to the value of each field of the point at time ts.
+	Next(ts int64, vals []tsm1.Value)
+
+	// Clone returns a copy of the model, without its state.
+	Clone() FieldsModel
+}
+
+// SumFieldsModel generates float fields whose values always sum to a total, such as
+// usage_user, usage_system and usage_idle summing to 100. The share of each field
+// follows a random walk.
+type SumFieldsModel struct {
+	fields []string
+	total  float64
+	r      *rand.Rand
+	w      []float64
+}
+
+func NewSumFieldsModel(fields []string, total float64) *SumFieldsModel {
+	return &SumFieldsModel{fields: fields, total: total, w: make([]float64, len(fields))}
+}
+
+func (m *SumFieldsModel) Fields() []string { return m.fields }
+
+func (m *SumFieldsModel) Reset(r *rand.Rand, _ int64) {
+	m.r = r
+	for i := range m.w {
+		m.w[i] = r.Float64() + 0.1
+	}
+}
+
+func (m *SumFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	var sum float64
+	for i := range m.w {
+		m.w[i] *= math.Exp(m.r.NormFloat64() * 0.1)
+		sum += m.w[i]
+	}
+	for i := range vals {
+		vals[i] = tsm1.NewFloatValue(ts, m.total*m.w[i]/sum)
+	}
+}
+
+func (m *SumFieldsModel) Clone() FieldsModel { return NewSumFieldsModel(m.fields, m.total) }
+
+// DerivedFieldsModel generates float fields where the first follows a random walk between
+// 0 and 100 and each other field is derived from it as scale × first + normally distributed
+// noise with a standard deviation of noise.
+type DerivedFieldsModel struct {
+	fields []string
+	scale  float64
+	noise  float64
+	r      *rand.Rand
+	x      float64
+}
+
+func NewDerivedFieldsModel(fields []string, scale, noise float64) *DerivedFieldsModel {
+	return &DerivedFieldsModel{fields: fields, scale: scale, noise: noise}
+}
+
+func (m *DerivedFieldsModel) Fields() []string { return m.fields }
+
+func (m *DerivedFieldsModel) Reset(r *rand.Rand, _ int64) {
+	m.r = r
+	m.x = r.Float64() * 100
+}
+
+func (m *DerivedFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	m.x = math.Max(0, math.Min(100, m.x+m.r.NormFloat64()))
+	vals[0] = tsm1.NewFloatValue(ts, m.x)
+	for i := 1; i < len(vals); i++ {
+		vals[i] = tsm1.NewFloatValue(ts, m.scale*m.x+m.r.NormFloat64()*m.noise)
+	}
+}
+
+func (m *DerivedFieldsModel) Clone() FieldsModel {
+	return NewDerivedFieldsModel(m.fields, m.scale, m.noise)
+}
+
+// CounterFieldsModel generates integer counters which increase at a shared, random rate,
+// each by its factor of the rate, such as packets and bytes of 1,500 byte packets.
+//
+// The count of a series is a function of time, from an initial count and a rate per second
+// drawn from the hash of the series key and the first field, less a random amount of the increase since the
+// previous point. Counters therefore increase across shards, which generate each series
+// independently.
+type CounterFieldsModel struct {
+	fields  []string
+	factors []int64
+	r       *rand.Rand
+	base    float64
+	rate    float64
+	prev    int64 // time of the previous point, or 0 for the first point of a series
+}
+
+func NewCounterFieldsModel(fields []string, factors []int64) *CounterFieldsModel {
+	return &CounterFieldsModel{fields: fields, factors: factors}
+}
+
+func (m *CounterFieldsModel) Fields() []string { return m.fields }
+
+func (m *CounterFieldsModel) Reset(r *rand.Rand, series int64) {
+	sr := rand.New(rand.NewSource(series ^ keyHash([]byte(m.fields[0]))))
+	m.r = r
+	m.base = float64(sr.Int63n(1000000))
+	m.rate = 1 + sr.Float64()*99
+	m.prev = 0
+}
+
+func (m *CounterFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	x := m.base + m.rate*float64(ts)/float64(time.Second)
+	if m.prev != 0 && ts > m.prev {
+		x -= m.r.Float64() * m.rate * float64(ts-m.prev) / float64(time.Second)
+	}
+	m.prev = ts
+
+	n := int64(x)
+	for i := range vals {
+		vals[i] = tsm1.NewIntegerValue(ts, n*m.factors[i])
+	}
+}
+
+func (m *CounterFieldsModel) Clone() FieldsModel { return NewCounterFieldsModel(m.fields, m.factors) }
+
+// GaugeField describes a field of a GaugeFieldsModel.
+type GaugeField struct {
+	Name     string
+	Min, Max float64
+	Step     float64 // standard deviation of each step of the random walk; zero for a constant
+	Daily    float64 // amplitude of a daily cycle added to the random walk
+	Integer  bool
+}
+
+// GaugeFieldsModel generates independent gauges, such as temperatures or free memory, each
+// following a random walk within its range, starting from a random value, with an optional
+// daily cycle.
+type GaugeFieldsModel struct {
+	fields []GaugeField
+	names  []string
+	r      *rand.Rand
+	x      []float64
+}
+
+func NewGaugeFieldsModel(fields []GaugeField) *GaugeFieldsModel {
+	names := make([]string, len(fields))
+	for i := range fields {
+		names[i] = fields[i].Name
+	}
+	return &GaugeFieldsModel{fields: fields, names: names, x: make([]float64, len(fields))}
+}
+
+func (m *GaugeFieldsModel) Fields() []string { return m.names }
+
+func (m *GaugeFieldsModel) Reset(r *rand.Rand, _ int64) {
+	m.r = r
+	for i, f := range m.fields {
+		m.x[i] = f.Min + r.Float64()*(f.Max-f.Min)
+	}
+}
+
+func (m *GaugeFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	day := 2 * math.Pi * float64(ts%int64(24*time.Hour)) / float64(24*time.Hour)
+	for i, f := range m.fields {
+		if f.Step > 0 {
+			m.x[i] = math.Max(f.Min, math.Min(f.Max, m.x[i]+m.r.NormFloat64()*f.Step))
+		}
+		v := math.Max(f.Min, math.Min(f.Max, m.x[i]-f.Daily*math.Cos(day)))
+		if f.Integer {
+			vals[i] = tsm1.NewIntegerValue(ts, int64(math.Round(v)))
+		} else {
+			vals[i] = tsm1.NewFloatValue(ts, v)
+		}
+	}
+}
+
+func (m *GaugeFieldsModel) Clone() FieldsModel { return NewGaugeFieldsModel(m.fields) }
+
+// CapacityFieldsModel generates the usage of a fixed capacity, such as of a disk or memory,
+// as the integer fields total, used and free and the float field used_percent, any of whose
+// names may be empty to omit the field. The capacity of each series is drawn between min and
+// max, and the fraction used follows a random walk.
+type CapacityFieldsModel struct {
+	names    [4]string
+	fields   []string
+	min, max float64
+	r        *rand.Rand
+	total    float64
+	used     float64 // fraction of total
+}
+
+func NewCapacityFieldsModel(total, used, free, usedPercent string, min, max float64) *CapacityFieldsModel {
+	m := &CapacityFieldsModel{names: [4]string{total, used, free, usedPercent}, min: min, max: max}
+	for _, name := range m.names {
+		if name != "" {
+			m.fields = append(m.fields, name)
+		}
+	}
+	return m
+}
+
+func (m *CapacityFieldsModel) Fields() []string { return m.fields }
+
+func (m *CapacityFieldsModel) Reset(r *rand.Rand, _ int64) {
+	m.r = r
+	m.total = math.Round(m.min + r.Float64()*(m.max-m.min))
+	m.used = 0.1 + r.Float64()*0.8
+}
+
+func (m *CapacityFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	m.used = math.Max(0.01, math.Min(0.99, m.used+m.r.NormFloat64()*0.005))
+	used := math.Round(m.total * m.used)
+	i := 0
+	for j, name := range m.names {
+		if name == "" {
+			continue
+		}
+		switch j {
+		case 0:
+			vals[i] = tsm1.NewIntegerValue(ts, int64(m.total))
+		case 1:
+			vals[i] = tsm1.NewIntegerValue(ts, int64(used))
+		case 2:
+			vals[i] = tsm1.NewIntegerValue(ts, int64(m.total-used))
+		case 3:
+			vals[i] = tsm1.NewFloatValue(ts, 100*used/m.total)
+		}
+		i++
+	}
+}
+
+func (m *CapacityFieldsModel) Clone() FieldsModel {
+	return NewCapacityFieldsModel(m.names[0], m.names[1], m.names[2], m.names[3], m.min, m.max)
+}
+
+// CompositeFieldsModel combines the fields of several models, such as counters and
+// gauges of the same measurement.
+type CompositeFieldsModel struct {
+	models []FieldsModel
+	fields []string
+}
+
+func NewCompositeFieldsModel(models ...FieldsModel) *CompositeFieldsModel {
+	var fields []string
+	for _, m := range models {
+		fields = append(fields, m.Fields()...)
+	}
+	return &CompositeFieldsModel{models: models, fields: fields}
+}
+
+func (m *CompositeFieldsModel) Fields() []string { return m.fields }
+
+func (m *CompositeFieldsModel) Reset(r *rand.Rand, series int64) {
+	for _, fm := range m.models {
+		fm.Reset(r, series)
+	}
+}
+
+func (m *CompositeFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	for _, fm := range m.models {
+		n := len(fm.Fields())
+		fm.Next(ts, vals[:n])
+		vals = vals[n:]
+	}
+}
+
+func (m *CompositeFieldsModel) Clone() FieldsModel {
+	models := make([]FieldsModel, len(m.models))
+	for i := range m.models {
+		models[i] = m.models[i].Clone()
+	}
+	return NewCompositeFieldsModel(models...)
+}
+
+// fieldsRows generates the values of every field of each point of a series of a FieldsModel
+// once, for the FieldValuesSequence of each field to read its own.
+type fieldsRows struct {
+	m      FieldsModel
+	r      *rand.Rand
+	seed   int64 // seed of the source of each series, with its key
+	series int64 // hash of the series key of cols
+	ok     bool  // whether cols holds the values of series
+	cols   []tsm1.Values
+	point  []tsm1.Value
+	state  struct {
+		n int
+		t int64
+		d int64
+	}
+
+	// clones are the rows shared by the clones of the sequences of each field, where the
+	// i-th clone of each sequence shares clones[i]
+	clones []*fieldsRows
+}
+
+// load generates the values of each field of the series with the key hash series, unless
+// they have already been generated.
+func (rs *fieldsRows) load(series int64) {
+	if rs.ok && rs.series == series {
+		return
+	}
+	rs.series, rs.ok = series, true
+
+	rs.r.Seed(rs.seed ^ series)
+	rs.m.Reset(rand.New(rand.NewSource(rs.r.Int63())), series)
+	for j := range rs.cols {
+		rs.cols[j] = rs.cols[j][:0]
+	}
+	t := rs.state.t
+	for i := 0; i < rs.state.n; i++ {
+		rs.m.Next(t, rs.point)
+		for j, v := range rs.point {
+			rs.cols[j] = append(rs.cols[j], v)
+		}
+		t += rs.state.d
+	}
+}
+
+// clone returns the i-th clone of rs, with a copy of the model.
+func (rs *fieldsRows) clone(i int) *fieldsRows {
+	for len(rs.clones) <= i {
+		c := newFieldsRows(rs.m.Clone(), rs.seed)
+		c.state = rs.state
+		rs.clones = append(rs.clones, c)
+	}
+	return rs.clones[i]
+}
+
+func newFieldsRows(m FieldsModel, seed int64) *fieldsRows {
+	n := len(m.Fields())
+	return &fieldsRows{
+		m:     m,
+		r:     rand.New(rand.NewSource(seed)),
+		seed:  seed,
+		cols:  make([]tsm1.Values, n),
+		point: make([]tsm1.Value, n),
+	}
+}
+
+// FieldValuesSequence is the values sequence of a single field of a FieldsModel. The
+// sequences of each field of a model, created by NewFieldValuesSequences, generate the
+// related values of the same points, which are generated once for all fields.
+//
+// The values of a series are determined by its key, as set by SeedSeries, so the sequences
+// of each field generate the same points for a series, whichever field is read first.
+type FieldValuesSequence struct {
+	rows   *fieldsRows
+	field  int
+	series int64 // hash of the current series key
+	clones int   // number of clones of the sequence
+	vals   tsm1.Values
+	i      int // index of the next value of the series
+}
+
+// NewFieldValuesSequences returns the sequence of n values of each field of m, starting at
+// start. The model of each series is seeded from r.
+func NewFieldValuesSequences(m FieldsModel, n int, start time.Time, delta time.Duration, r *rand.Rand) []*FieldValuesSequence {
+	rows := newFieldsRows(m, r.Int63())
+	rows.state.n = n
+	rows.state.t = start.UnixNano()
+	rows.state.d = int64(delta)
+
+	res := make([]*FieldValuesSequence, len(m.Fields()))
+	for j := range res {
+		res[j] = &FieldValuesSequence{rows: rows, field: j}
+	}
+	return res
+}
+
+// SeedSeries sets the series key of the values generated once the sequence is reset.
+func (g *FieldValuesSequence) SeedSeries(key []byte) {
+	g.series = keyHash(key)
+}
+
+func (g *FieldValuesSequence) Reset() {
+	g.i = 0
+}
+
+func (g *FieldValuesSequence) Next() bool {
+	if g.i == 0 {
+		g.rows.load(g.series)
+	}
+
+	col := g.rows.cols[g.field]
+	if g.i == len(col) {
+		return false
+	}
+
+	c := min(len(col)-g.i, tsdb.DefaultMaxPointsPerBlock)
+	g.vals = col[g.i : g.i+c]
+	g.i += c
+	return true
+}
+
+func (g *FieldValuesSequence) Values() tsm1.Values { return g.vals }
+
+// Clone returns a copy of g with a new model, which generates the same values for each
+// series seeded by SeedSeries. The i-th clones of the sequences of each field of a model
+// share their model, and so remain related.
+func (g *FieldValuesSequence) Clone() ingen.ValuesSequence {
+	c := &FieldValuesSequence{
+		rows:  g.rows.clone(g.clones),
+		field: g.field,
+	}
+	g.clones++
+	return c
+}
+
+// FieldsSeriesGenerator generates a key for each field of each tag set, in key order,
+// with the values sequence of the field. The values sequence of a field is reset once
+// for each series, so sequences created with sources in the same state, such as those
+// of FieldValuesSequence, generate related values for the fields of a series.
+type FieldsSeriesGenerator struct {
+	name   []byte
+	tags   TagsSequence
+	fields []string
+	vgs    []ingen.ValuesSequence
+	i      int
+	buf    []byte
+}
+
+// NewFieldsSeriesGenerator returns a generator of the fields of each tag set of tags,
+// where vgs is the values sequence of each field.
+func NewFieldsSeriesGenerator(name []byte, fields []string, vgs []ingen.ValuesSequence, tags TagsSequence) *FieldsSeriesGenerator {
+	fields = append([]string(nil), fields...)
+	vgs = append([]ingen.ValuesSequence(nil), vgs...)
+	sort.Sort(fieldValues{fields, vgs})
+	return &FieldsSeriesGenerator{name: name, tags: tags, fields: fields, vgs: vgs, i: len(fields) - 1}
+}
+
+func (g *FieldsSeriesGenerator) Next() bool {
+	g.i++
+	if g.i == len(g.fields) {
+		if !g.tags.Next() {
+			return false
+		}
+		g.i = 0
+		g.buf = models.AppendMakeKey(g.buf[:0], g.name, g.tags.Value())
+	}
+
+	if s, ok := g.vgs[g.i].(SeriesSeeder); ok {
+		s.SeedSeries(g.buf)
+	}
+	g.vgs[g.i].Reset()
+	return true
+}
+
+func (g *FieldsSeriesGenerator) Key() []byte {
+	return tsm1.SeriesFieldKeyBytes(string(g.buf), g.fields[g.i])
+}
+
+func (g *FieldsSeriesGenerator) ValuesGenerator() ingen.ValuesSequence { return g.vgs[g.i] }
+
+// Count returns the number of keys generated by g.
+func (g *FieldsSeriesGenerator) Count() int { return g.tags.Count() * len(g.fields) }
+
+// Split divides g into at most n generators over ordered, non-overlapping ranges of tag sets.
+// Each generator is assigned a clone of the values sequence of each field.
+func (g *FieldsSeriesGenerator) Split(n int) []ingen.SeriesGenerator {
+	ts, ok := g.tags.(interface{ Split(n int) []TagsSequence })
+	if !ok {
+		return []ingen.SeriesGenerator{g}
+	}
+	for _, vg := range g.vgs {
+		if _, ok := vg.(interface{ Clone() ingen.ValuesSequence }); !ok {
+			return []ingen.SeriesGenerator{g}
+		}
+	}
+
+	parts := ts.Split(n)
+	res := make([]ingen.SeriesGenerator, len(parts))
+	for i := range parts {
+		vgs := make([]ingen.ValuesSequence, len(g.vgs))
+		for j, vg := range g.vgs {
+			vgs[j] = vg.(interface{ Clone() ingen.ValuesSequence }).Clone()
+		}
+		res[i] = NewFieldsSeriesGenerator(g.name, g.fields, vgs, parts[i])
+	}
+	return res
+}
+
+type fieldValues struct {
+	fields []string
+	vgs    []ingen.ValuesSequence
+}
+
+func (f fieldValues) Len() int           { return len(f.fields) }
+func (f fieldValues) Less(i, j int) bool { return f.fields[i] < f.fields[j] }
+func (f fieldValues) Swap(i, j int) {
+	f.fields[i], f.fields[j] = f.fields[j], f.fields[i]
+	f.vgs[i], f.vgs[j] = f.vgs[j], f.vgs[i]
+}
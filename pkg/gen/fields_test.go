@@ -0,0 +1,125 @@
+package gen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// countingFieldsModel counts the points generated by a FieldsModel.
+type countingFieldsModel struct {
+	FieldsModel
+	n *int
+}
+
+func (m *countingFieldsModel) Next(ts int64, vals []tsm1.Value) {
+	*m.n++
+	m.FieldsModel.Next(ts, vals)
+}
+
+func (m *countingFieldsModel) Clone() FieldsModel {
+	return &countingFieldsModel{FieldsModel: m.FieldsModel.Clone(), n: m.n}
+}
+
+// readValues returns the values of each key of g.
+func readValues(g ingen.SeriesGenerator) map[string]tsm1.Values {
+	res := make(map[string]tsm1.Values)
+	for g.Next() {
+		res[string(g.Key())] = readSequence(g.ValuesGenerator())
+	}
+	return res
+}
+
+// readSequence returns a copy of the values of vg.
+func readSequence(vg ingen.ValuesSequence) tsm1.Values {
+	var vals tsm1.Values
+	for vg.Next() {
+		for _, v := range vg.Values() {
+			vals = append(vals, tsm1.NewValue(v.UnixNano(), v.Value()))
+		}
+	}
+	return vals
+}
+
+func TestFieldValuesSequences(t *testing.T) {
+	const (
+		points = 1500
+		total  = 100
+	)
+	fields := []string{"a", "b", "c", "d"}
+	tags := 6
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newSeries := func(n *int) *FieldsSeriesGenerator {
+		m := &countingFieldsModel{FieldsModel: NewSumFieldsModel(fields, total), n: n}
+		vgs := make([]ingen.ValuesSequence, len(fields))
+		for j, vg := range NewFieldValuesSequences(m, points, start, time.Second, rand.New(rand.NewSource(1))) {
+			vgs[j] = vg
+		}
+		return NewFieldsSeriesGenerator([]byte("m0"), fields, vgs, newTestTagsSequence(tags))
+	}
+
+	// the fields of each point sum to the total
+	checkSums := func(t *testing.T, vals map[string]tsm1.Values) {
+		t.Helper()
+		sums := make(map[string][]float64)
+		for key, vs := range vals {
+			series, _ := tsm1.SeriesAndFieldFromCompositeKey([]byte(key))
+			if len(vs) != points {
+				t.Fatalf("%s: got %d values, expected %d", key, len(vs), points)
+			}
+			if sums[string(series)] == nil {
+				sums[string(series)] = make([]float64, points)
+			}
+			for i, v := range vs {
+				sums[string(series)][i] += v.Value().(float64)
+			}
+		}
+		for series, s := range sums {
+			for i := range s {
+				if math.Abs(s[i]-total) > 1e-9 {
+					t.Fatalf("%s: fields of point %d sum to %v, expected %v", series, i, s[i], float64(total))
+				}
+			}
+		}
+	}
+
+	var n int
+	want := readValues(newSeries(&n))
+	if len(want) != tags*len(fields) {
+		t.Fatalf("got %d keys, expected %d", len(want), tags*len(fields))
+	}
+	checkSums(t, want)
+	// each point is generated once for all fields
+	if n != tags*points {
+		t.Errorf("generated %d points, expected %d", n, tags*points)
+	}
+
+	t.Run("split", func(t *testing.T) {
+		var n int
+		got := make(map[string]tsm1.Values)
+		for _, p := range newSeries(&n).Split(4) {
+			for key, vs := range readValues(p) {
+				got[key] = vs
+			}
+		}
+		checkSums(t, got)
+		if n != tags*points {
+			t.Errorf("generated %d points, expected %d", n, tags*points)
+		}
+		for key, vs := range want {
+			if len(got[key]) != len(vs) {
+				t.Fatalf("%s: got %d values, expected %d", key, len(got[key]), len(vs))
+			}
+			for i := range vs {
+				if got[key][i] != vs[i] {
+					t.Fatalf("%s: value %d: got %v, expected %v", key, i, got[key][i], vs[i])
+				}
+			}
+		}
+	})
+}
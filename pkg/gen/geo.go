@@ -0,0 +1,234 @@
+package gen
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// GeoConfig specifies the tracks of the moving objects of a GeoSeriesGenerator.
+type GeoConfig struct {
+	// Home is the region in which the home of each object is drawn, as the
+	// south west and north east corners.
+	Home [2]s2.LatLng
+
+	// Radius is the distance in meters from its home beyond which an object turns towards it.
+	Radius float64
+
+	// Level is the level of the S2 cell IDs of the s2_cell_id tag.
+	Level int
+
+	// MinTrip, MaxTrip and MinIdle, MaxIdle bound the durations of each trip, and of the
+	// idle time between trips, during which an object reports no position.
+	MinTrip, MaxTrip time.Duration
+	MinIdle, MaxIdle time.Duration
+}
+
+// MaxS2Level is the level of the smallest S2 cells.
+const MaxS2Level = 30
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371010.0
+
+// GeoSeriesGenerator generates the tracks of moving objects, such as a fleet of vehicles, in the
+// schema used by the Flux geo package. Each tag set of a TagsSequence identifies an object, which
+// makes trips from its home at intervals of delta, reporting its position as the fields lat and lon.
+// Each point is tagged by the token of the S2 cell containing it, s2_cell_id, and the ID of the
+// trip, tid, so the points of a trip are spread across a series for each cell visited.
+//
+// The tracks of the objects are generated when the first series is requested, and the points
+// of each series are held in memory until the series is generated.
+type GeoSeriesGenerator struct {
+	name  []byte
+	tags  TagsSequence
+	cfg   GeoConfig
+	n     int
+	start int64
+	delta int64
+	seed  int64
+
+	series []*geoSeries
+	i      int
+	vg     *SliceValuesSequence
+	key    []byte
+}
+
+type geoSeries struct {
+	key      string
+	lat, lon tsm1.Values
+}
+
+// NewGeoSeriesGenerator returns a generator of the tracks of the objects of tags, of up to n
+// points each from start, drawing trips from sources seeded from seed and each object's tags.
+func NewGeoSeriesGenerator(name []byte, tags TagsSequence, cfg GeoConfig, n int, start time.Time, delta time.Duration, seed int64) *GeoSeriesGenerator {
+	return &GeoSeriesGenerator{
+		name:  name,
+		tags:  tags,
+		cfg:   cfg,
+		n:     n,
+		start: start.UnixNano(),
+		delta: int64(delta),
+		seed:  seed,
+		i:     -1,
+		vg:    new(SliceValuesSequence),
+	}
+}
+
+func (g *GeoSeriesGenerator) Next() bool {
+	if g.series == nil {
+		g.generate()
+	}
+
+	// each series has a key for each of the fields lat and lon, in order
+	g.i++
+	if g.i >= 2*len(g.series) {
+		g.series = g.series[:0]
+		return false
+	}
+
+	s := g.series[g.i/2]
+	if g.i%2 == 0 {
+		g.key = tsm1.SeriesFieldKeyBytes(s.key, "lat")
+		g.vg.SetValues(s.lat)
+	} else {
+		g.key = tsm1.SeriesFieldKeyBytes(s.key, "lon")
+		g.vg.SetValues(s.lon)
+		g.series[g.i/2] = nil
+	}
+	return true
+}
+
+func (g *GeoSeriesGenerator) Key() []byte                           { return g.key }
+func (g *GeoSeriesGenerator) ValuesGenerator() ingen.ValuesSequence { return g.vg }
+
+// generate generates the tracks of every object, sorting the resulting series by key.
+func (g *GeoSeriesGenerator) generate() {
+	series := make(map[string]*geoSeries)
+	for g.tags.Next() {
+		g.track(g.tags.Value(), series)
+	}
+
+	g.series = make([]*geoSeries, 0, len(series))
+	for _, s := range series {
+		g.series = append(g.series, s)
+	}
+	sort.Slice(g.series, func(i, j int) bool { return g.series[i].key < g.series[j].key })
+}
+
+// track generates the trips of the object tags, adding each point to its series.
+func (g *GeoSeriesGenerator) track(tags models.Tags, series map[string]*geoSeries) {
+	h := models.NewInlineFNV64a()
+	for _, t := range tags {
+		h.Write(t.Key)
+		h.Write(t.Value)
+	}
+	id := int64(h.Sum64())
+
+	// the home of an object is the same in every shard
+	hr := rand.New(rand.NewSource(id))
+	sw, ne := g.cfg.Home[0], g.cfg.Home[1]
+	home := s2.LatLng{
+		Lat: sw.Lat + (ne.Lat-sw.Lat)*s1.Angle(hr.Float64()),
+		Lng: sw.Lng + (ne.Lng-sw.Lng)*s1.Angle(hr.Float64()),
+	}
+
+	r := rand.New(rand.NewSource(g.seed ^ id))
+	var (
+		t   = g.start + r.Int63n(int64(g.cfg.MaxIdle)+1)
+		end = g.start + int64(g.n)*g.delta
+		buf []byte
+	)
+	for t < end {
+		// each trip begins near home, heading in a random direction
+		pos := offset(home, r.Float64()*g.cfg.Radius, r.Float64()*2*math.Pi)
+		heading := r.Float64() * 2 * math.Pi
+		speed := 5 + r.Float64()*20
+		tid := strconv.FormatUint(uint64(id)^uint64(t), 36)
+
+		tripEnd := t + between(r, g.cfg.MinTrip, g.cfg.MaxTrip)
+		for ; t < tripEnd && t < end; t += g.delta {
+			cell := s2.CellIDFromLatLng(pos).Parent(g.cfg.Level).ToToken()
+			buf = models.AppendMakeKey(buf[:0], g.name, tags.Merge(map[string]string{"s2_cell_id": cell, "tid": tid}))
+			s := series[string(buf)]
+			if s == nil {
+				s = &geoSeries{key: string(buf)}
+				series[s.key] = s
+			}
+			s.lat = append(s.lat, tsm1.NewFloatValue(t, pos.Lat.Degrees()))
+			s.lon = append(s.lon, tsm1.NewFloatValue(t, pos.Lng.Degrees()))
+
+			// turn gradually, heading home once beyond the radius
+			heading += r.NormFloat64() * 0.3
+			if home.Distance(pos).Radians()*earthRadius > g.cfg.Radius {
+				heading = bearing(pos, home) + r.NormFloat64()*0.2
+			}
+			speed = math.Max(2, math.Min(35, speed+r.NormFloat64()*2))
+			pos = offset(pos, speed*float64(g.delta)/float64(time.Second), heading)
+		}
+		t += between(r, g.cfg.MinIdle, g.cfg.MaxIdle)
+
+		// align the next trip to the interval of points
+		t = g.start + (t-g.start+g.delta-1)/g.delta*g.delta
+	}
+}
+
+// between returns a random duration between min and max.
+func between(r *rand.Rand, min, max time.Duration) int64 {
+	if max <= min {
+		return int64(min)
+	}
+	return int64(min) + r.Int63n(int64(max-min)+1)
+}
+
+// offset returns the position d meters from p, in the direction of bearing, in radians from north.
+func offset(p s2.LatLng, d, bearing float64) s2.LatLng {
+	lat1, lng1 := p.Lat.Radians(), p.Lng.Radians()
+	a := d / earthRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(a) + math.Cos(lat1)*math.Sin(a)*math.Cos(bearing))
+	lng2 := lng1 + math.Atan2(math.Sin(bearing)*math.Sin(a)*math.Cos(lat1), math.Cos(a)-math.Sin(lat1)*math.Sin(lat2))
+	return s2.LatLngFromDegrees(lat2*180/math.Pi, math.Remainder(lng2*180/math.Pi, 360))
+}
+
+// bearing returns the initial bearing from p to q, in radians from north.
+func bearing(p, q s2.LatLng) float64 {
+	lat1, lat2 := p.Lat.Radians(), q.Lat.Radians()
+	dLng := q.Lng.Radians() - p.Lng.Radians()
+	return math.Atan2(math.Sin(dLng)*math.Cos(lat2), math.Cos(lat1)*math.Sin(lat2)-math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng))
+}
+
+// SliceValuesSequence is a sequence of the values of a slice, in blocks of at most
+// tsdb.DefaultMaxPointsPerBlock values.
+type SliceValuesSequence struct {
+	all  tsm1.Values
+	vals tsm1.Values
+	i    int
+}
+
+// SetValues sets the values of the sequence and resets it.
+func (g *SliceValuesSequence) SetValues(vals tsm1.Values) {
+	g.all = vals
+	g.Reset()
+}
+
+func (g *SliceValuesSequence) Reset() { g.i = 0 }
+
+func (g *SliceValuesSequence) Next() bool {
+	if g.i >= len(g.all) {
+		return false
+	}
+	c := min(len(g.all)-g.i, tsdb.DefaultMaxPointsPerBlock)
+	g.vals = g.all[g.i : g.i+c]
+	g.i += c
+	return true
+}
+
+func (g *SliceValuesSequence) Values() tsm1.Values { return g.vals }
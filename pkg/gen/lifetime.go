@@ -0,0 +1,114 @@
+package gen
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// LifetimeValuesSequence limits the values of a fraction of series to a lifetime within
+// the time range of the shard, such as a container which ran for 2 hours. On each Reset,
+// the series is chosen to have a lifetime with probability fraction, which is of a random
+// duration between min and max, starting at a random time such that it ends within the shard.
+// Values of the underlying sequence outside the lifetime are discarded.
+type LifetimeValuesSequence struct {
+	vs         ingen.ValuesSequence
+	r          *rand.Rand
+	seed       int64 // seed of the source of each series, with its key
+	buf        tsm1.Values
+	vals       tsm1.Values
+	start, end int64 // lifetime of the current series
+	state      struct {
+		start, end int64 // time range of the shard
+		fraction   float64
+		min, max   int64
+	}
+}
+
+// NewLifetimeValuesSequence returns a sequence of the values of vs, over the time range
+// [start, end), within the lifetime of each series.
+func NewLifetimeValuesSequence(vs ingen.ValuesSequence, start, end time.Time, fraction float64, min, max time.Duration, r *rand.Rand) *LifetimeValuesSequence {
+	g := &LifetimeValuesSequence{vs: vs, r: r, seed: r.Int63(), buf: make(tsm1.Values, 0, tsdb.DefaultMaxPointsPerBlock)}
+	g.state.start = start.UnixNano()
+	g.state.end = end.UnixNano()
+	g.state.fraction = fraction
+	g.state.min = int64(min)
+	g.state.max = int64(max)
+	g.Reset()
+	return g
+}
+
+// SeedSeries seeds the source of the lifetime of the series key, and that of the underlying sequence.
+func (g *LifetimeValuesSequence) SeedSeries(key []byte) {
+	g.r.Seed(g.seed ^ keyHash(key))
+	if s, ok := g.vs.(SeriesSeeder); ok {
+		s.SeedSeries(key)
+	}
+}
+
+func (g *LifetimeValuesSequence) Reset() {
+	g.vs.Reset()
+	g.start, g.end = g.state.start, g.state.end
+	if g.r.Float64() >= g.state.fraction {
+		return
+	}
+
+	span := g.state.end - g.state.start
+	d := g.state.min
+	if g.state.max > d {
+		d += g.r.Int63n(g.state.max - d + 1)
+	}
+	if d > span {
+		d = span
+	}
+	if d < span {
+		g.start += g.r.Int63n(span - d + 1)
+	}
+	g.end = g.start + d
+}
+
+func (g *LifetimeValuesSequence) Next() bool {
+	for g.vs.Next() {
+		vals := g.vs.Values()
+		if len(vals) == 0 {
+			continue
+		}
+		if vals[0].UnixNano() >= g.end {
+			return false
+		}
+		if vals[len(vals)-1].UnixNano() < g.start {
+			continue
+		}
+
+		g.buf = g.buf[:0]
+		for _, v := range vals {
+			if ts := v.UnixNano(); ts >= g.start && ts < g.end {
+				g.buf = append(g.buf, v)
+			}
+		}
+		if len(g.buf) > 0 {
+			g.vals = g.buf
+			return true
+		}
+	}
+	return false
+}
+
+func (g *LifetimeValuesSequence) Values() tsm1.Values { return g.vals }
+
+// Clone returns a copy of g, cloning the underlying sequence, which must implement Clone,
+// with a new source which draws the same lifetime for each series seeded by SeedSeries.
+func (g *LifetimeValuesSequence) Clone() ingen.ValuesSequence {
+	c := &LifetimeValuesSequence{
+		vs:    g.vs.(interface{ Clone() ingen.ValuesSequence }).Clone(),
+		r:     rand.New(rand.NewSource(g.seed)),
+		seed:  g.seed,
+		buf:   make(tsm1.Values, 0, tsdb.DefaultMaxPointsPerBlock),
+		state: g.state,
+	}
+	c.Reset()
+	return c
+}
@@ -0,0 +1,312 @@
+package gen
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// Prometheus metric types.
+const (
+	PrometheusHistogram = "histogram"
+	PrometheusSummary   = "summary"
+)
+
+var (
+	// DefaultPrometheusBuckets are the upper bounds of the buckets of the Prometheus client's default histogram.
+	DefaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultPrometheusQuantiles are the quantiles of a summary.
+	DefaultPrometheusQuantiles = []float64{.5, .9, .99}
+)
+
+// PrometheusMetric describes a Prometheus histogram or summary of observations, such as request
+// durations, drawn from a log-normal distribution.
+type PrometheusMetric struct {
+	Name      string
+	Type      string
+	Buckets   []float64 // upper bounds of the buckets of a histogram, excluding +Inf
+	Quantiles []float64 // quantiles of a summary
+	Median    float64   // median of the observations
+	Sigma     float64   // standard deviation of the logarithm of the observations
+	Rate      float64   // mean number of observations per second
+}
+
+// NewPrometheusSeriesGenerator returns a generator of the series of the metric m, as written by
+// the Prometheus remote write API, with a field named value. The series of a histogram are the
+// cumulative count of observations less than or equal to the upper bound of each bucket, tagged le,
+// in the measurement <name>_bucket, and the count and sum of the observations in <name>_count and
+// <name>_sum. The series of a summary are the value of each quantile of the observations between
+// points, tagged quantile, in the measurement <name>, and the count and sum of the observations.
+// The observations of each tag set of keys and vals, generated for n points from start, are
+// identical across the series of the tag set.
+//
+// The count of the observations of a tag set is a function of time, from an initial count drawn
+// from the hash of the tag set, increasing at Rate less a random amount of the increase since the
+// previous point, and the buckets and sum are those of the distribution for the count. Counts
+// therefore increase across shards, which generate each tag set independently.
+func NewPrometheusSeriesGenerator(m *PrometheusMetric, keys []string, vals []Sequence, n int, start time.Time, delta time.Duration, seed int64) ingen.SeriesGenerator {
+	var gens []ingen.SeriesGenerator
+	switch m.Type {
+	case PrometheusHistogram:
+		les := make([]string, len(m.Buckets)+1)
+		for i, b := range m.Buckets {
+			les[i] = formatFloat(b)
+		}
+		les[len(m.Buckets)] = "+Inf"
+		gens = append(gens, newPrometheusSeries(m, m.Name+"_bucket", promBucket, "le", les, keys, vals, n, start, delta, seed))
+	case PrometheusSummary:
+		qs := make([]string, len(m.Quantiles))
+		for i, q := range m.Quantiles {
+			qs[i] = formatFloat(q)
+		}
+		gens = append(gens, newPrometheusSeries(m, m.Name, promQuantile, "quantile", qs, keys, vals, n, start, delta, seed))
+	}
+	gens = append(gens,
+		newPrometheusSeries(m, m.Name+"_count", promCount, "", nil, keys, vals, n, start, delta, seed),
+		newPrometheusSeries(m, m.Name+"_sum", promSum, "", nil, keys, vals, n, start, delta, seed),
+	)
+	return NewConcatSeriesGenerator(gens...)
+}
+
+// SeriesN returns the number of series of each tag set of the metric.
+func (m *PrometheusMetric) SeriesN() int {
+	if m.Type == PrometheusHistogram {
+		return len(m.Buckets) + 3
+	}
+	return len(m.Quantiles) + 2
+}
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+
+// statistics of the observations of a Prometheus metric
+const (
+	promBucket = iota
+	promQuantile
+	promCount
+	promSum
+)
+
+// prometheusSeries generates the series of a single measurement of a Prometheus metric.
+type prometheusSeries struct {
+	m     *PrometheusMetric
+	name  []byte
+	stat  int
+	label string         // key of the le or quantile tag; empty if none
+	index map[string]int // index of the bucket or quantile of each value of the label
+	tags  TagsSequence
+	vg    *prometheusValuesSequence
+	seed  int64
+	buf   []byte
+}
+
+func newPrometheusSeries(m *PrometheusMetric, name string, stat int, label string, labels []string, keys []string, vals []Sequence, n int, start time.Time, delta time.Duration, seed int64) *prometheusSeries {
+	s := &prometheusSeries{
+		m:     m,
+		name:  []byte(name),
+		stat:  stat,
+		label: label,
+		seed:  seed,
+		vg:    newPrometheusValuesSequence(m, n, start, delta),
+	}
+
+	keys = append([]string(nil), keys...)
+	tv := make([]Sequence, len(vals))
+	for i := range vals {
+		tv[i] = vals[i].Clone()
+	}
+	if label != "" {
+		s.index = make(map[string]int, len(labels))
+		for i, v := range labels {
+			s.index[v] = i
+		}
+		keys = append(keys, label)
+		tv = append(tv, NewStringsSequence(labels))
+	}
+	s.tags = NewTagsValuesSequenceKeysValues(keys, tv)
+	return s
+}
+
+func (s *prometheusSeries) Next() bool {
+	if !s.tags.Next() {
+		return false
+	}
+
+	// the observations of a tag set are seeded from the tags other than the label
+	tags := s.tags.Value()
+	h := models.NewInlineFNV64a()
+	h.Write([]byte(s.m.Name))
+	j := 0
+	for _, t := range tags {
+		if string(t.Key) == s.label {
+			j = s.index[string(t.Value)]
+			continue
+		}
+		h.Write(t.Key)
+		h.Write(t.Value)
+	}
+	s.vg.reset(s.seed, int64(h.Sum64()), s.stat, j)
+
+	s.buf = models.AppendMakeKey(s.buf[:0], s.name, tags)
+	return true
+}
+
+func (s *prometheusSeries) Key() []byte                           { return tsm1.SeriesFieldKeyBytes(string(s.buf), "value") }
+func (s *prometheusSeries) ValuesGenerator() ingen.ValuesSequence { return s.vg }
+
+// prometheusValuesSequence generates a statistic of the observations of a Prometheus metric.
+type prometheusValuesSequence struct {
+	m     *PrometheusMetric
+	r     *rand.Rand
+	seed  int64
+	hash  int64 // hash of the tag set
+	stat  int
+	j     int       // index of the bucket or quantile
+	cdf   []float64 // fraction of the observations in each bucket, cumulatively
+	mean  float64
+	base  float64 // count of the observations at the Unix epoch
+	count float64
+	prev  int64 // time of the previous point, or 0 for the first point
+	obs   []float64
+	buf   tsm1.Values
+	vals  tsm1.Values
+	n     int
+	t     int64
+	state struct {
+		n int
+		t int64
+		d int64
+	}
+}
+
+func newPrometheusValuesSequence(m *PrometheusMetric, n int, start time.Time, delta time.Duration) *prometheusValuesSequence {
+	g := &prometheusValuesSequence{
+		m:    m,
+		r:    rand.New(rand.NewSource(0)),
+		buf:  make(tsm1.Values, tsdb.DefaultMaxPointsPerBlock),
+		cdf:  make([]float64, len(m.Buckets)+1),
+		mean: m.Median * math.Exp(m.Sigma*m.Sigma/2),
+	}
+	for i, b := range m.Buckets {
+		g.cdf[i] = 0.5 * math.Erfc(-math.Log(b/m.Median)/(m.Sigma*math.Sqrt2))
+	}
+	g.cdf[len(m.Buckets)] = 1
+	g.state.n = n
+	g.state.t = start.UnixNano()
+	g.state.d = int64(delta)
+	return g
+}
+
+// reset starts the series of the statistic stat of the observations of the tag set with
+// the given hash, drawn from a source seeded from seed and the hash.
+func (g *prometheusValuesSequence) reset(seed, hash int64, stat, j int) {
+	g.seed, g.hash, g.stat, g.j = seed, hash, stat, j
+	g.Reset()
+}
+
+// Reset restarts the observations. The initial count depends only on the tag set, so
+// it is the same in every shard.
+func (g *prometheusValuesSequence) Reset() {
+	g.n = g.state.n
+	g.t = g.state.t
+	g.base = float64(rand.New(rand.NewSource(g.hash)).Int63n(100000))
+	g.count, g.prev = 0, 0
+	g.r.Seed(g.seed ^ g.hash)
+}
+
+func (g *prometheusValuesSequence) Next() bool {
+	if g.n == 0 {
+		return false
+	}
+
+	c := min(g.n, tsdb.DefaultMaxPointsPerBlock)
+	g.n -= c
+	g.vals = g.buf[:c]
+
+	for i := range g.vals {
+		g.observe()
+		g.vals[i] = tsm1.NewFloatValue(g.t, g.value())
+		g.t += g.state.d
+	}
+	return true
+}
+
+// maxQuantileSample is the maximum number of the observations between points drawn to
+// compute the quantiles of a summary.
+const maxQuantileSample = 100
+
+// observe advances the count of observations to the time g.t and, for a summary, draws a
+// sample of the observations since the previous point.
+func (g *prometheusValuesSequence) observe() {
+	x := g.base + g.m.Rate*float64(g.t)/float64(time.Second)
+	if g.prev != 0 && g.t > g.prev {
+		x -= g.r.Float64() * g.m.Rate * float64(g.t-g.prev) / float64(time.Second)
+	}
+	g.prev = g.t
+
+	count := math.Floor(x)
+	k := int(math.Min(count-g.count, maxQuantileSample))
+	g.count = count
+	if g.stat != promQuantile {
+		return
+	}
+
+	if k < 1 {
+		k = 1
+	}
+	g.obs = g.obs[:0]
+	for ; k > 0; k-- {
+		g.obs = append(g.obs, g.m.Median*math.Exp(g.m.Sigma*g.r.NormFloat64()))
+	}
+}
+
+func (g *prometheusValuesSequence) value() float64 {
+	switch g.stat {
+	case promBucket:
+		return math.Floor(g.count * g.cdf[g.j])
+	case promQuantile:
+		sort.Float64s(g.obs)
+		return g.obs[int(g.m.Quantiles[g.j]*float64(len(g.obs)-1))]
+	case promCount:
+		return g.count
+	default:
+		return g.count * g.mean
+	}
+}
+
+func (g *prometheusValuesSequence) Values() tsm1.Values { return g.vals }
+
+// StringsSequence is a sequence of strings, which are sorted.
+type StringsSequence struct {
+	vals []string
+	i    int
+}
+
+func NewStringsSequence(vals []string) *StringsSequence {
+	vals = append([]string(nil), vals...)
+	sort.Strings(vals)
+	return &StringsSequence{vals: vals}
+}
+
+func (s *StringsSequence) Next() bool {
+	s.i++
+	if s.i == len(s.vals) {
+		s.i = 0
+	}
+	return true
+}
+
+func (s *StringsSequence) Value() string { return s.vals[s.i] }
+func (s *StringsSequence) Count() int    { return len(s.vals) }
+
+func (s *StringsSequence) Clone() Sequence {
+	c := *s
+	return &c
+}
@@ -0,0 +1,211 @@
+package gen
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+// RollupSeriesGenerator generates the rollups of the series of several generators over
+// windows of a fixed duration, aligned to the Unix epoch, as a continuous query grouping
+// by time would. Each field f of a series is rolled up as the fields count_f, max_f, mean_f
+// and min_f of the same series, where max_f, mean_f and min_f are only generated for float
+// and integer fields. As for InfluxQL, mean_f is a float, and max_f and min_f are of the type
+// of f. The value of each window is written at the start of the window.
+//
+// The generators are read in the order given, such as that of the shards of the shard groups
+// of a retention policy, and the values of a series generated by several generators must be
+// in time order. The values of a window must be generated by a single generator.
+type RollupSeriesGenerator struct {
+	gens       []ingen.SeriesGenerator
+	ok         []bool // generator has a current key
+	started    bool   // first key of each generator has been read
+	window     int64
+	start, end int64
+
+	series []byte
+	fields map[string]*rollup
+	keys   []rollupKey
+	i      int
+	key    []byte
+	vg     *SliceValuesSequence
+}
+
+// rollup accumulates the statistics of each window of a field.
+type rollup struct {
+	numeric bool
+	windows []int64
+	count   []int64
+	sum     []float64
+	min     []float64
+	max     []float64
+	integer bool
+}
+
+type rollupKey struct {
+	field string
+	vals  tsm1.Values
+}
+
+// NewRollupSeriesGenerator returns a generator of the rollups of the series of gens over
+// windows of window, limited to the windows starting within start and end.
+func NewRollupSeriesGenerator(gens []ingen.SeriesGenerator, window time.Duration, start, end time.Time) *RollupSeriesGenerator {
+	return &RollupSeriesGenerator{
+		gens:   gens,
+		ok:     make([]bool, len(gens)),
+		window: int64(window),
+		start:  start.UnixNano(),
+		end:    end.UnixNano(),
+		vg:     new(SliceValuesSequence),
+	}
+}
+
+func (g *RollupSeriesGenerator) Next() bool {
+	if !g.started {
+		// the generators are only read once the rollups are written
+		for i := range g.gens {
+			g.ok[i] = g.gens[i].Next()
+		}
+		g.started = true
+	}
+	for {
+		g.i++
+		if g.i < len(g.keys) {
+			k := &g.keys[g.i]
+			g.key = tsm1.SeriesFieldKeyBytes(string(g.series), k.field)
+			g.vg.SetValues(k.vals)
+			return true
+		}
+		if !g.nextSeries() {
+			return false
+		}
+	}
+}
+
+// nextSeries reads the keys of the series with the lowest key of every generator,
+// and computes its rollups.
+func (g *RollupSeriesGenerator) nextSeries() bool {
+	var series []byte
+	for i, gen := range g.gens {
+		if !g.ok[i] {
+			continue
+		}
+		sk, _ := tsm1.SeriesAndFieldFromCompositeKey(gen.Key())
+		if series == nil || bytes.Compare(sk, series) < 0 {
+			series = sk
+		}
+	}
+	if series == nil {
+		return false
+	}
+	g.series = append(g.series[:0], series...)
+
+	g.fields = make(map[string]*rollup)
+	for i, gen := range g.gens {
+		for g.ok[i] {
+			sk, field := tsm1.SeriesAndFieldFromCompositeKey(gen.Key())
+			if !bytes.Equal(sk, g.series) {
+				break
+			}
+			r := g.fields[string(field)]
+			if r == nil {
+				r = new(rollup)
+				g.fields[string(field)] = r
+			}
+			vg := gen.ValuesGenerator()
+			for vg.Next() {
+				for _, v := range vg.Values() {
+					g.add(r, v)
+				}
+			}
+			g.ok[i] = gen.Next()
+		}
+	}
+
+	g.keys = g.keys[:0]
+	for field, r := range g.fields {
+		if len(r.windows) == 0 {
+			continue
+		}
+		g.keys = append(g.keys, rollupKey{field: "count_" + field, vals: r.values(r.count, nil, false)})
+		if r.numeric {
+			mean := make([]float64, len(r.sum))
+			for j := range mean {
+				mean[j] = r.sum[j] / float64(r.count[j])
+			}
+			g.keys = append(g.keys,
+				rollupKey{field: "max_" + field, vals: r.values(nil, r.max, r.integer)},
+				rollupKey{field: "mean_" + field, vals: r.values(nil, mean, false)},
+				rollupKey{field: "min_" + field, vals: r.values(nil, r.min, r.integer)},
+			)
+		}
+	}
+	sort.Slice(g.keys, func(i, j int) bool { return g.keys[i].field < g.keys[j].field })
+	g.i = -1
+	return true
+}
+
+// add adds the value v to the window containing it, if the window starts within the time range.
+func (g *RollupSeriesGenerator) add(r *rollup, v tsm1.Value) {
+	ts := v.UnixNano()
+	w := ts - ((ts%g.window)+g.window)%g.window
+	if w < g.start || w >= g.end {
+		return
+	}
+
+	var (
+		x       float64
+		numeric = true
+	)
+	switch v := v.Value().(type) {
+	case float64:
+		x = v
+	case int64:
+		x = float64(v)
+		r.integer = true
+	case uint64:
+		x = float64(v)
+		r.integer = true
+	default:
+		numeric = false
+	}
+	r.numeric = numeric
+
+	n := len(r.windows)
+	if n == 0 || r.windows[n-1] != w {
+		r.windows = append(r.windows, w)
+		r.count = append(r.count, 0)
+		r.sum = append(r.sum, 0)
+		r.min = append(r.min, math.Inf(1))
+		r.max = append(r.max, math.Inf(-1))
+		n++
+	}
+	r.count[n-1]++
+	r.sum[n-1] += x
+	r.min[n-1] = math.Min(r.min[n-1], x)
+	r.max[n-1] = math.Max(r.max[n-1], x)
+}
+
+// values returns the value of each window, of ints if not nil, otherwise of floats, written
+// as integers if integer is set.
+func (r *rollup) values(ints []int64, floats []float64, integer bool) tsm1.Values {
+	vals := make(tsm1.Values, len(r.windows))
+	for i, w := range r.windows {
+		switch {
+		case ints != nil:
+			vals[i] = tsm1.NewIntegerValue(w, ints[i])
+		case integer:
+			vals[i] = tsm1.NewIntegerValue(w, int64(floats[i]))
+		default:
+			vals[i] = tsm1.NewFloatValue(w, floats[i])
+		}
+	}
+	return vals
+}
+
+func (g *RollupSeriesGenerator) Key() []byte                           { return g.key }
+func (g *RollupSeriesGenerator) ValuesGenerator() ingen.ValuesSequence { return g.vg }
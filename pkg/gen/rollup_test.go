@@ -0,0 +1,160 @@
+package gen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
+)
+
+var rollupTestStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newRollupTestGenerator returns the generator of shard group i, of 24h starting at
+// rollupTestStart, of a float field f, with a lifetime for half of the series, and an
+// integer field i. The second shard group has more series than the first.
+func newRollupTestGenerator(i int) ingen.SeriesGenerator {
+	const points = 100
+	start := rollupTestStart.Add(time.Duration(i) * 24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+	delta := 24 * time.Hour / points
+
+	r := rand.New(rand.NewSource(int64(i)))
+	f := NewLifetimeValuesSequence(NewFloatRandomValuesSequence(points, start, delta, 100, r), start, end, 0.5, time.Hour, 12*time.Hour, r)
+	v := NewIntegerConstantValuesSequence(points, start, delta, int64(i+1))
+	tags := newTestTagsSequence(3+i, 2)
+	return NewFieldsSeriesGenerator([]byte("m0"), []string{"f", "i"}, []ingen.ValuesSequence{f, v}, tags)
+}
+
+// bruteForceRollups returns the count, max, mean and min of each window, starting within
+// start and end, of the values of each key of the generators.
+func bruteForceRollups(gens []ingen.SeriesGenerator, window time.Duration, start, end time.Time) map[string]tsm1.Values {
+	type stats struct {
+		count         int64
+		sum, min, max float64
+		integer       bool
+	}
+	windows := make(map[string]map[int64]*stats)
+	for _, g := range gens {
+		for key, vals := range readValues(g) {
+			for _, v := range vals {
+				w := v.UnixNano() / int64(window) * int64(window)
+				if w < start.UnixNano() || w >= end.UnixNano() {
+					continue
+				}
+				if windows[key] == nil {
+					windows[key] = make(map[int64]*stats)
+				}
+				s := windows[key][w]
+				if s == nil {
+					s = &stats{min: math.Inf(1), max: math.Inf(-1)}
+					windows[key][w] = s
+				}
+				var x float64
+				switch v := v.Value().(type) {
+				case float64:
+					x = v
+				case int64:
+					x = float64(v)
+					s.integer = true
+				}
+				s.count++
+				s.sum += x
+				s.min = math.Min(s.min, x)
+				s.max = math.Max(s.max, x)
+			}
+		}
+	}
+
+	res := make(map[string]tsm1.Values)
+	for key, ws := range windows {
+		series, field := tsm1.SeriesAndFieldFromCompositeKey([]byte(key))
+		rollupKey := func(name string) string {
+			return string(tsm1.SeriesFieldKeyBytes(string(series), name+"_"+string(field)))
+		}
+		for w := start.UnixNano(); w < end.UnixNano(); w += int64(window) {
+			s := ws[w]
+			if s == nil {
+				continue
+			}
+			res[rollupKey("count")] = append(res[rollupKey("count")], tsm1.NewIntegerValue(w, s.count))
+			res[rollupKey("mean")] = append(res[rollupKey("mean")], tsm1.NewFloatValue(w, s.sum/float64(s.count)))
+			if s.integer {
+				res[rollupKey("max")] = append(res[rollupKey("max")], tsm1.NewIntegerValue(w, int64(s.max)))
+				res[rollupKey("min")] = append(res[rollupKey("min")], tsm1.NewIntegerValue(w, int64(s.min)))
+			} else {
+				res[rollupKey("max")] = append(res[rollupKey("max")], tsm1.NewFloatValue(w, s.max))
+				res[rollupKey("min")] = append(res[rollupKey("min")], tsm1.NewFloatValue(w, s.min))
+			}
+		}
+	}
+	return res
+}
+
+func TestRollupSeriesGenerator(t *testing.T) {
+	tests := []struct {
+		name       string
+		window     time.Duration
+		start, end time.Duration // from rollupTestStart
+	}{
+		{name: "all", window: 3 * time.Hour, start: 0, end: 48 * time.Hour},
+		{name: "hourly", window: time.Hour, start: 0, end: 48 * time.Hour},
+		{name: "second group", window: 3 * time.Hour, start: 24 * time.Hour, end: 48 * time.Hour},
+		{name: "overlapping", window: 2 * time.Hour, start: 12 * time.Hour, end: 36 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := rollupTestStart.Add(tt.start), rollupTestStart.Add(tt.end)
+			want := bruteForceRollups([]ingen.SeriesGenerator{newRollupTestGenerator(0), newRollupTestGenerator(1)}, tt.window, start, end)
+
+			g := NewRollupSeriesGenerator([]ingen.SeriesGenerator{newRollupTestGenerator(0), newRollupTestGenerator(1)}, tt.window, start, end)
+			var (
+				keys []string
+				got  = make(map[string]tsm1.Values)
+			)
+			for g.Next() {
+				key := string(g.Key())
+				if n := len(keys); n > 0 && key <= keys[n-1] {
+					t.Fatalf("key %q does not follow %q", key, keys[n-1])
+				}
+				keys = append(keys, key)
+				got[key] = readSequence(g.ValuesGenerator())
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("got %d keys, expected %d", len(got), len(want))
+			}
+			for key, exp := range want {
+				vals, ok := got[key]
+				if !ok {
+					t.Fatalf("missing key %q", key)
+				}
+				if len(vals) != len(exp) {
+					t.Fatalf("%s: got %d values, expected %d", key, len(vals), len(exp))
+				}
+				for i := range exp {
+					if !rollupValuesEqual(vals[i], exp[i]) {
+						t.Fatalf("%s: value %d: got %v, expected %v", key, i, vals[i], exp[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// rollupValuesEqual returns whether a and b have the same time, type and value, allowing
+// for the rounding of the sum of floats in a different order.
+func rollupValuesEqual(a, b tsm1.Value) bool {
+	if a.UnixNano() != b.UnixNano() {
+		return false
+	}
+	switch x := a.Value().(type) {
+	case float64:
+		y, ok := b.Value().(float64)
+		return ok && math.Abs(x-y) <= 1e-9*math.Max(1, math.Abs(y))
+	default:
+		return a.Value() == b.Value()
+	}
+}
@@ -9,6 +9,7 @@ type Sequence interface {
 	Next() bool
 	Value() string
 	Count() int
+	Clone() Sequence
 }
 
 type CounterByteSequence struct {
@@ -52,8 +53,14 @@ func (s *CounterByteSequence) update() {
 func (s *CounterByteSequence) Count() int    { return s.end - s.s }
 func (s *CounterByteSequence) Value() string { return s.val }
 
+func (s *CounterByteSequence) Clone() Sequence {
+	c := *s
+	return &c
+}
+
 type ConstantStringSequence string
 
-func (ConstantStringSequence) Next() bool      { return true }
-func (s ConstantStringSequence) Value() string { return string(s) }
-func (ConstantStringSequence) Count() int      { return 1 }
+func (ConstantStringSequence) Next() bool        { return true }
+func (s ConstantStringSequence) Value() string   { return string(s) }
+func (ConstantStringSequence) Count() int        { return 1 }
+func (s ConstantStringSequence) Clone() Sequence { return s }
@@ -6,6 +6,14 @@ import (
 	"github.com/influxdata/ingen"
 )
 
+// SeriesSeeder is implemented by values sequences which draw values from a random source.
+// Generators call SeedSeries with the series key of each series before resetting the sequence
+// for it, so that the values of a series do not depend on the series generated before it by
+// the same sequence, such as when the series of a generator are split.
+type SeriesSeeder interface {
+	SeedSeries(key []byte)
+}
+
 type SeriesGenerator struct {
 	name  []byte
 	tags  TagsSequence
@@ -28,11 +36,120 @@ func (g *SeriesGenerator) Next() bool {
 		return false
 	}
 
-	g.vg.Reset()
 	g.buf = models.AppendMakeKey(g.buf[:0], g.name, g.tags.Value())
+	if s, ok := g.vg.(SeriesSeeder); ok {
+		s.SeedSeries(g.buf)
+	}
+	g.vg.Reset()
 
 	return true
 }
 
 func (g *SeriesGenerator) Key() []byte                           { return tsm1.SeriesFieldKeyBytes(string(g.buf), g.field) }
 func (g *SeriesGenerator) ValuesGenerator() ingen.ValuesSequence { return g.vg }
+
+// Split divides g into at most n generators over ordered, non-overlapping ranges of keys.
+// Each generator is assigned a clone of the values sequence.
+func (g *SeriesGenerator) Split(n int) []ingen.SeriesGenerator {
+	ts, ok := g.tags.(interface{ Split(n int) []TagsSequence })
+	if !ok {
+		return []ingen.SeriesGenerator{g}
+	}
+	vc, ok := g.vg.(interface{ Clone() ingen.ValuesSequence })
+	if !ok {
+		return []ingen.SeriesGenerator{g}
+	}
+
+	parts := ts.Split(n)
+	res := make([]ingen.SeriesGenerator, len(parts))
+	for i := range parts {
+		res[i] = NewSeriesGenerator(g.name, g.field, vc.Clone(), parts[i])
+	}
+	return res
+}
+
+// ConcatSeriesGenerator generates the series of each generator in turn. The keys of each
+// generator must precede those of the next.
+type ConcatSeriesGenerator struct {
+	gens []ingen.SeriesGenerator
+}
+
+func NewConcatSeriesGenerator(gens ...ingen.SeriesGenerator) *ConcatSeriesGenerator {
+	return &ConcatSeriesGenerator{gens: gens}
+}
+
+func (g *ConcatSeriesGenerator) Next() bool {
+	for len(g.gens) > 0 {
+		if g.gens[0].Next() {
+			return true
+		}
+		g.gens = g.gens[1:]
+	}
+	return false
+}
+
+func (g *ConcatSeriesGenerator) Key() []byte { return g.gens[0].Key() }
+
+func (g *ConcatSeriesGenerator) ValuesGenerator() ingen.ValuesSequence {
+	return g.gens[0].ValuesGenerator()
+}
+
+// Split divides the keys of g into at most n generators over ordered, non-overlapping
+// ranges of about the same number of keys, splitting each generator in proportion to its
+// share of the keys. Each generator must implement Count, returning the number of its keys,
+// otherwise g is not divided. Split must be called before the first call to Next.
+func (g *ConcatSeriesGenerator) Split(n int) []ingen.SeriesGenerator {
+	counts := make([]int, len(g.gens))
+	total := 0
+	for i, sg := range g.gens {
+		c, ok := sg.(interface{ Count() int })
+		if !ok {
+			return []ingen.SeriesGenerator{g}
+		}
+		counts[i] = c.Count()
+		total += counts[i]
+	}
+	if n <= 1 || total == 0 {
+		return []ingen.SeriesGenerator{g}
+	}
+
+	// divide each generator into parts of about total/n keys, in key order
+	type part struct {
+		sg    ingen.SeriesGenerator
+		count float64
+	}
+	var parts []part
+	for i, sg := range g.gens {
+		if counts[i] == 0 {
+			continue
+		}
+		sgs := []ingen.SeriesGenerator{sg}
+		if s, ok := sg.(ingen.SeriesGeneratorSplitter); ok {
+			if k := (counts[i]*n + total - 1) / total; k > 1 {
+				sgs = s.Split(k)
+			}
+		}
+		for _, p := range sgs {
+			parts = append(parts, part{sg: p, count: float64(counts[i]) / float64(len(sgs))})
+		}
+	}
+
+	// concatenate consecutive parts until each generator has about total/n keys
+	var (
+		res  []ingen.SeriesGenerator
+		gens []ingen.SeriesGenerator
+		sum  float64
+	)
+	for _, p := range parts {
+		gens = append(gens, p.sg)
+		sum += p.count
+		if len(res) < n-1 && sum >= float64(total*(len(res)+1))/float64(n) {
+			res = append(res, NewConcatSeriesGenerator(gens...))
+			gens = nil
+		}
+	}
+	if len(gens) > 0 {
+		res = append(res, NewConcatSeriesGenerator(gens...))
+	}
+	return res
+}
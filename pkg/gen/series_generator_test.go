@@ -0,0 +1,72 @@
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/ingen"
+)
+
+// newTestConcatSeriesGenerator returns the concatenation of a generator of the float
+// fields f0 and f1 of measurement m0 and a generator of the integer field i of m1.
+func newTestConcatSeriesGenerator() *ConcatSeriesGenerator {
+	const points = 10
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	delta := time.Hour / points
+
+	f0 := NewFloatRandomValuesSequence(points, start, delta, 100, rand.New(rand.NewSource(1)))
+	f1 := NewFloatRandomValuesSequence(points, start, delta, 100, rand.New(rand.NewSource(2)))
+	m0 := NewFieldsSeriesGenerator([]byte("m0"), []string{"f0", "f1"}, []ingen.ValuesSequence{f0, f1}, newTestTagsSequence(3, 4))
+
+	i := NewIntegerConstantValuesSequence(points, start, delta, 1)
+	m1 := NewFieldsSeriesGenerator([]byte("m1"), []string{"i"}, []ingen.ValuesSequence{i}, newTestTagsSequence(5))
+	return NewConcatSeriesGenerator(m0, m1)
+}
+
+func TestConcatSeriesGenerator_Split(t *testing.T) {
+	var keys []string
+	want := make(map[string]string)
+	for g := newTestConcatSeriesGenerator(); g.Next(); {
+		key := string(g.Key())
+		keys = append(keys, key)
+		want[key] = fmt.Sprint(readSequence(g.ValuesGenerator()))
+	}
+	if len(keys) != 3*4*2+5 {
+		t.Fatalf("got %d keys, expected %d", len(keys), 3*4*2+5)
+	}
+
+	spanned := false
+	for n := 1; n <= len(keys)+2; n++ {
+		t.Run(fmt.Sprintf("%d", n), func(t *testing.T) {
+			parts := newTestConcatSeriesGenerator().Split(n)
+			if len(parts) > n {
+				t.Fatalf("got %d parts, expected at most %d", len(parts), n)
+			}
+
+			var got []string
+			for _, p := range parts {
+				var measurements []string
+				for p.Next() {
+					key := string(p.Key())
+					got = append(got, key)
+					if vals := fmt.Sprint(readSequence(p.ValuesGenerator())); vals != want[key] {
+						t.Fatalf("%s: got values %s, expected %s", key, vals, want[key])
+					}
+					if m := key[:strings.IndexByte(key, ',')]; len(measurements) == 0 || measurements[len(measurements)-1] != m {
+						measurements = append(measurements, m)
+					}
+				}
+				if len(measurements) > 1 {
+					spanned = true
+				}
+			}
+			assertKeys(t, got, keys)
+		})
+	}
+	if !spanned {
+		t.Error("no part spanned the boundary between the generators")
+	}
+}
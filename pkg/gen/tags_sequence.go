@@ -15,10 +15,11 @@ type TagsSequence interface {
 }
 
 type TagsValuesSequence struct {
-	tags models.Tags
-	vals []Sequence
-	n    int
-	max  int
+	tags  models.Tags
+	vals  []Sequence
+	start int
+	n     int
+	max   int
 }
 
 func NewTagsValuesSequenceKeysValues(keys []string, vals []Sequence) *TagsValuesSequence {
@@ -78,7 +79,52 @@ func (s *TagsValuesSequence) Next() bool {
 }
 
 func (s *TagsValuesSequence) Value() models.Tags { return s.tags }
-func (s *TagsValuesSequence) Count() int         { return s.max }
+func (s *TagsValuesSequence) Count() int         { return s.max - s.start }
+
+// Split divides the tag sets into at most n ordered, non-overlapping sequences.
+// Split must be called before the first call to Next.
+func (s *TagsValuesSequence) Split(n int) []TagsSequence {
+	count := s.Count()
+	if n > count {
+		n = count
+	}
+	if n <= 1 {
+		return []TagsSequence{s}
+	}
+
+	res := make([]TagsSequence, n)
+	for i := 0; i < n; i++ {
+		start, end := s.start+count*i/n, s.start+count*(i+1)/n
+		res[i] = s.seek(start, end)
+	}
+	return res
+}
+
+// seek returns a copy of s positioned at the tag set with index start, ending before end.
+func (s *TagsValuesSequence) seek(start, end int) *TagsValuesSequence {
+	c := &TagsValuesSequence{
+		tags:  s.tags.Clone(),
+		vals:  make([]Sequence, len(s.vals)),
+		start: start,
+		n:     start,
+		max:   end,
+	}
+	for i := range s.vals {
+		c.vals[i] = s.vals[i].Clone()
+	}
+
+	// advance each value sequence from its digit of s.start to its digit of start
+	from, to := s.start, start
+	for j := len(c.vals) - 1; j >= 0; j-- {
+		v := c.vals[j]
+		n := v.Count()
+		for k := (to%n - from%n + n) % n; k > 0; k-- {
+			v.Next()
+		}
+		from, to = from/n, to/n
+	}
+	return c
+}
 
 type keyValues struct {
 	keys []string
@@ -91,3 +137,67 @@ func (k keyValues) Swap(i, j int) {
 	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
 	k.vals[i], k.vals[j] = k.vals[j], k.vals[i]
 }
+
+// TagsListSequence is a sequence of a list of tag sets, such as those describing hosts,
+// which are not the product of independent tag values.
+type TagsListSequence struct {
+	tags []models.Tags
+	i    int
+}
+
+// NewTagsListSequence returns a sequence of tags, sorted in the order of their series keys.
+func NewTagsListSequence(tags []models.Tags) *TagsListSequence {
+	keys := make([]string, len(tags))
+	for i, t := range tags {
+		keys[i] = string(models.MakeKey(nil, t))
+	}
+	tags = append([]models.Tags(nil), tags...)
+	sort.Sort(tagsKeys{keys, tags})
+	return &TagsListSequence{tags: tags, i: -1}
+}
+
+func (s *TagsListSequence) Next() bool {
+	if s.i+1 >= len(s.tags) {
+		return false
+	}
+	s.i++
+	return true
+}
+
+func (s *TagsListSequence) Value() models.Tags { return s.tags[s.i] }
+func (s *TagsListSequence) Count() int         { return len(s.tags) }
+
+// Clone returns a new sequence of the tag sets of s, sharing the sorted list.
+func (s *TagsListSequence) Clone() *TagsListSequence {
+	return &TagsListSequence{tags: s.tags, i: -1}
+}
+
+// Split divides the tag sets into at most n ordered, non-overlapping sequences.
+// Split must be called before the first call to Next.
+func (s *TagsListSequence) Split(n int) []TagsSequence {
+	count := s.Count()
+	if n > count {
+		n = count
+	}
+	if n <= 1 {
+		return []TagsSequence{s}
+	}
+
+	res := make([]TagsSequence, n)
+	for i := 0; i < n; i++ {
+		res[i] = &TagsListSequence{tags: s.tags[count*i/n : count*(i+1)/n], i: -1}
+	}
+	return res
+}
+
+type tagsKeys struct {
+	keys []string
+	tags []models.Tags
+}
+
+func (k tagsKeys) Len() int           { return len(k.keys) }
+func (k tagsKeys) Less(i, j int) bool { return k.keys[i] < k.keys[j] }
+func (k tagsKeys) Swap(i, j int) {
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+	k.tags[i], k.tags[j] = k.tags[j], k.tags[i]
+}
@@ -0,0 +1,93 @@
+package gen
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newTestTagsSequence(cards ...int) *TagsValuesSequence {
+	vals := make([]Sequence, len(cards))
+	for i, c := range cards {
+		vals[i] = NewCounterByteSequenceCount(c)
+	}
+	return NewTagsValuesSequenceValues("tag", vals)
+}
+
+// readTagsKeys returns the key of each tag set of s.
+func readTagsKeys(s TagsSequence) []string {
+	var keys []string
+	for s.Next() {
+		keys = append(keys, string(s.Value().HashKey()))
+	}
+	return keys
+}
+
+func TestTagsValuesSequence_Split(t *testing.T) {
+	for _, cards := range [][]int{{1}, {7}, {2, 3}, {3, 1, 4}, {5, 2, 3, 2}} {
+		want := readTagsKeys(newTestTagsSequence(cards...))
+		for n := 1; n <= len(want)+2; n++ {
+			t.Run(fmt.Sprintf("%v/%d", cards, n), func(t *testing.T) {
+				parts := newTestTagsSequence(cards...).Split(n)
+				if exp := min(n, len(want)); len(parts) != exp {
+					t.Fatalf("got %d parts, expected %d", len(parts), exp)
+				}
+
+				var got []string
+				count := 0
+				for _, p := range parts {
+					count += p.Count()
+					keys := readTagsKeys(p)
+					if len(keys) != p.Count() {
+						t.Errorf("part generated %d tag sets, expected Count %d", len(keys), p.Count())
+					}
+					got = append(got, keys...)
+				}
+				if count != len(want) {
+					t.Errorf("parts count %d tag sets, expected %d", count, len(want))
+				}
+				assertKeys(t, got, want)
+			})
+		}
+	}
+}
+
+// TestTagsValuesSequence_SplitPart tests splitting a part of a split sequence, which seeks
+// from a tag set other than the first.
+func TestTagsValuesSequence_SplitPart(t *testing.T) {
+	cards := []int{3, 4, 5}
+	want := readTagsKeys(newTestTagsSequence(cards...))
+
+	var got []string
+	for _, p := range newTestTagsSequence(cards...).Split(3) {
+		for _, q := range p.(*TagsValuesSequence).Split(4) {
+			got = append(got, readTagsKeys(q)...)
+		}
+	}
+	assertKeys(t, got, want)
+}
+
+func TestTagsValuesSequence_seek(t *testing.T) {
+	cards := []int{2, 3, 4}
+	all := readTagsKeys(newTestTagsSequence(cards...))
+	for start := 0; start <= len(all); start++ {
+		for end := start; end <= len(all); end++ {
+			got := readTagsKeys(newTestTagsSequence(cards...).seek(start, end))
+			if len(got) != end-start {
+				t.Fatalf("seek(%d, %d): got %d tag sets, expected %d", start, end, len(got), end-start)
+			}
+			assertKeys(t, got, all[start:end])
+		}
+	}
+}
+
+func assertKeys(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, expected %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("key %d: got %q, expected %q", i, got[i], want[i])
+		}
+	}
+}
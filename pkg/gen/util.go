@@ -1,5 +1,14 @@
 package gen
 
+import "github.com/influxdata/influxdb/models"
+
+// keyHash returns the FNV-1a hash of key.
+func keyHash(key []byte) int64 {
+	h := models.NewInlineFNV64a()
+	h.Write(key)
+	return int64(h.Sum64())
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -6,14 +6,17 @@ import (
 
 	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+	"github.com/influxdata/ingen"
 )
 
 type IntegerConstantValuesSequence struct {
-	buf   tsm1.Values
-	vals  tsm1.Values
-	n     int
-	t     int64
-	state struct {
+	buf       tsm1.Values
+	vals      tsm1.Values
+	blocks    []ingen.EncodedBlock
+	blockSize int
+	n         int
+	t         int64
+	state     struct {
 		n int
 		t int64
 		d int64
@@ -54,12 +57,29 @@ func (g *IntegerConstantValuesSequence) Next() bool {
 
 func (g *IntegerConstantValuesSequence) Values() tsm1.Values { return g.vals }
 
+func (g *IntegerConstantValuesSequence) Clone() ingen.ValuesSequence {
+	c := &IntegerConstantValuesSequence{buf: make(tsm1.Values, tsdb.DefaultMaxPointsPerBlock), blocks: g.blocks, blockSize: g.blockSize, state: g.state}
+	c.Reset()
+	return c
+}
+
+// EncodedBlocks returns the encoded blocks of the sequence, which are identical for every series.
+func (g *IntegerConstantValuesSequence) EncodedBlocks(pointsPerBlock int) (blocks []ingen.EncodedBlock, err error) {
+	if g.blocks == nil || g.blockSize != pointsPerBlock {
+		g.blocks, err = encodeBlocks(g, pointsPerBlock)
+		g.blockSize = pointsPerBlock
+	}
+	return g.blocks, err
+}
+
 type FloatConstantValuesSequence struct {
-	buf   tsm1.Values
-	vals  tsm1.Values
-	n     int
-	t     int64
-	state struct {
+	buf       tsm1.Values
+	vals      tsm1.Values
+	blocks    []ingen.EncodedBlock
+	blockSize int
+	n         int
+	t         int64
+	state     struct {
 		n int
 		t int64
 		d int64
@@ -100,9 +120,26 @@ func (g *FloatConstantValuesSequence) Next() bool {
 
 func (g *FloatConstantValuesSequence) Values() tsm1.Values { return g.vals }
 
+func (g *FloatConstantValuesSequence) Clone() ingen.ValuesSequence {
+	c := &FloatConstantValuesSequence{buf: make(tsm1.Values, tsdb.DefaultMaxPointsPerBlock), blocks: g.blocks, blockSize: g.blockSize, state: g.state}
+	c.Reset()
+	return c
+}
+
+// EncodedBlocks returns the encoded blocks of the sequence, which are identical for every series.
+func (g *FloatConstantValuesSequence) EncodedBlocks(pointsPerBlock int) (blocks []ingen.EncodedBlock, err error) {
+	if g.blocks == nil || g.blockSize != pointsPerBlock {
+		g.blocks, err = encodeBlocks(g, pointsPerBlock)
+		g.blockSize = pointsPerBlock
+	}
+	return g.blocks, err
+}
+
 type FloatRandomValuesSequence struct {
 	buf   tsm1.Values
 	vals  tsm1.Values
+	r     *rand.Rand
+	seed  int64 // seed of the source of each series, with its key
 	n     int
 	t     int64
 	state struct {
@@ -113,8 +150,8 @@ type FloatRandomValuesSequence struct {
 	}
 }
 
-func NewFloatRandomValuesSequence(n int, start time.Time, delta time.Duration, scale float64) *FloatRandomValuesSequence {
-	g := &FloatRandomValuesSequence{buf: make(tsm1.Values, tsdb.DefaultMaxPointsPerBlock)}
+func NewFloatRandomValuesSequence(n int, start time.Time, delta time.Duration, scale float64, r *rand.Rand) *FloatRandomValuesSequence {
+	g := &FloatRandomValuesSequence{buf: make(tsm1.Values, tsdb.DefaultMaxPointsPerBlock), r: r, seed: r.Int63()}
 	g.state.n = n
 	g.state.t = start.UnixNano()
 	g.state.d = int64(delta)
@@ -123,6 +160,9 @@ func NewFloatRandomValuesSequence(n int, start time.Time, delta time.Duration, s
 	return g
 }
 
+// SeedSeries seeds the source of the values of the series key.
+func (g *FloatRandomValuesSequence) SeedSeries(key []byte) { g.r.Seed(g.seed ^ keyHash(key)) }
+
 func (g *FloatRandomValuesSequence) Reset() {
 	g.n = g.state.n
 	g.t = g.state.t
@@ -138,10 +178,63 @@ func (g *FloatRandomValuesSequence) Next() bool {
 	g.vals = g.buf[:c]
 
 	for i := range g.vals {
-		g.vals[i] = tsm1.NewFloatValue(g.t, rand.Float64() * g.state.scale)
+		g.vals[i] = tsm1.NewFloatValue(g.t, g.r.Float64()*g.state.scale)
 		g.t += g.state.d
 	}
 	return true
 }
 
 func (g *FloatRandomValuesSequence) Values() tsm1.Values { return g.vals }
+
+// Clone returns a copy of g with a new source, which generates the same values for each
+// series seeded by SeedSeries.
+func (g *FloatRandomValuesSequence) Clone() ingen.ValuesSequence {
+	c := &FloatRandomValuesSequence{buf: make(tsm1.Values, tsdb.DefaultMaxPointsPerBlock), r: rand.New(rand.NewSource(g.seed)), seed: g.seed, state: g.state}
+	c.Reset()
+	return c
+}
+
+// encodeBlocks encodes every block of vs, such that each contains at most n values,
+// resetting the sequence once complete. If n is zero, blocks are as produced by vs.
+func encodeBlocks(vs ingen.ValuesSequence, n int) ([]ingen.EncodedBlock, error) {
+	var (
+		blocks []ingen.EncodedBlock
+		buf    tsm1.Values
+	)
+
+	encode := func(vals tsm1.Values) error {
+		b, err := vals.Encode(nil)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, ingen.EncodedBlock{MinTime: vals.MinTime(), MaxTime: vals.MaxTime(), Data: b})
+		return nil
+	}
+
+	vs.Reset()
+	for vs.Next() {
+		vals := vs.Values()
+		if n == 0 {
+			if err := encode(vals); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		buf = append(buf, vals...)
+		for len(buf) >= n {
+			if err := encode(buf[:n]); err != nil {
+				return nil, err
+			}
+			buf = buf[:copy(buf, buf[n:])]
+		}
+	}
+	if len(buf) > 0 {
+		if err := encode(buf); err != nil {
+			return nil, err
+		}
+	}
+	vs.Reset()
+
+	return blocks, nil
+}
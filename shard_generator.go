@@ -0,0 +1,55 @@
+package ingen
+
+import (
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// ShardIndex returns the index of the shard, of a shard group of n shards, to which
+// the series key is assigned. Series are assigned by the FNV-1a hash of their key,
+// as points are by meta.ShardGroupInfo.ShardFor.
+func ShardIndex(seriesKey []byte, n int) int {
+	h := models.NewInlineFNV64a()
+	h.Write(seriesKey)
+	return int(h.Sum64() % uint64(n))
+}
+
+// shardSeriesGenerator generates the series of sg assigned to shard i of a shard group of n shards.
+type shardSeriesGenerator struct {
+	SeriesGenerator
+	n, i int
+}
+
+// NewShardSeriesGenerator returns a generator of the series of sg assigned to shard i of a
+// shard group of n shards, or sg if n is 1.
+func NewShardSeriesGenerator(sg SeriesGenerator, n, i int) SeriesGenerator {
+	if n <= 1 {
+		return sg
+	}
+	return &shardSeriesGenerator{SeriesGenerator: sg, n: n, i: i}
+}
+
+func (g *shardSeriesGenerator) Next() bool {
+	for g.SeriesGenerator.Next() {
+		seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey(g.Key())
+		if ShardIndex(seriesKey, g.n) == g.i {
+			return true
+		}
+	}
+	return false
+}
+
+// Split divides the key ranges of the underlying generator, if it implements
+// SeriesGeneratorSplitter, assigning the series of each range to the same shard.
+func (g *shardSeriesGenerator) Split(n int) []SeriesGenerator {
+	s, ok := g.SeriesGenerator.(SeriesGeneratorSplitter)
+	if !ok {
+		return []SeriesGenerator{g}
+	}
+
+	parts := s.Split(n)
+	for i := range parts {
+		parts[i] = NewShardSeriesGenerator(parts[i], g.n, g.i)
+	}
+	return parts
+}
@@ -1,6 +1,7 @@
 package ingen
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,37 +14,96 @@ const (
 	maxTSMFileSize = uint32(2048 * 1024 * 1024) // 2GB
 )
 
+// shardWriterConfig specifies the generation and level of the TSM files written
+// by a shardWriter and the limits at which it starts a new file.
+type shardWriterConfig struct {
+	Generation      int    // defaults to 1
+	Level           int    // compaction level, which is the sequence of the first file; defaults to 1
+	MaxFileSize     uint32 // defaults to maxTSMFileSize
+	MaxBlocksPerKey int    // if zero, limited only by the TSM index format
+}
+
 type shardWriter struct {
 	w        tsm1.TSMWriter
 	id       uint64
 	path     string
+	cfg      shardWriterConfig
 	gen, seq int
+	part     int
+	files    []string
 	err      error
+
+	key       []byte // last key written
+	keyBlocks int    // blocks written for key to the current file
 }
 
-func newShardWriter(id uint64, path string) *shardWriter {
-	t := &shardWriter{id: id, path: path, gen: 1, seq: 1}
+func newShardWriter(id uint64, path string, cfg shardWriterConfig) *shardWriter {
+	return newShardPartWriter(id, path, -1, cfg)
+}
+
+// newShardPartWriter returns a shardWriter for one of several key ranges of a shard.
+// Files are written using a temporary name until renamed by renameShardParts.
+func newShardPartWriter(id uint64, path string, part int, cfg shardWriterConfig) *shardWriter {
+	if cfg.Generation == 0 {
+		cfg.Generation = 1
+	}
+	if cfg.Level == 0 {
+		cfg.Level = 1
+	}
+	if cfg.MaxFileSize == 0 {
+		cfg.MaxFileSize = maxTSMFileSize
+	}
+	t := &shardWriter{id: id, path: path, cfg: cfg, gen: cfg.Generation, seq: cfg.Level, part: part}
 	t.nextTSM()
 	return t
 }
 
 func (t *shardWriter) Write(key []byte, values tsm1.Values) {
-	if t.err != nil {
+	if !t.prepare(key) {
 		return
 	}
+	t.handleErr(t.w.Write(key, values))
+}
 
-	if t.w.Size() > maxTSMFileSize {
+// WriteBlock writes a block of values for key which has already been encoded.
+func (t *shardWriter) WriteBlock(key []byte, minTime, maxTime int64, block []byte) {
+	if !t.prepare(key) {
+		return
+	}
+	t.handleErr(t.w.WriteBlock(key, minTime, maxTime, block))
+}
+
+// prepare starts a new TSM file if writing another block for key would exceed
+// the configured limits and returns false if the writer has failed.
+func (t *shardWriter) prepare(key []byte) bool {
+	if t.err != nil {
+		return false
+	}
+
+	if !bytes.Equal(key, t.key) {
+		t.key = append(t.key[:0], key...)
+		t.keyBlocks = 0
+	}
+
+	if t.w.Size() > t.cfg.MaxFileSize || (t.cfg.MaxBlocksPerKey > 0 && t.keyBlocks >= t.cfg.MaxBlocksPerKey) {
 		t.closeTSM()
 		t.nextTSM()
 	}
+	t.keyBlocks++
 
-	if err := t.w.Write(key, values); err != nil {
-		if err == tsm1.ErrMaxBlocksExceeded {
-			t.closeTSM()
-			t.nextTSM()
-		} else {
-			t.err = err
-		}
+	return t.err == nil
+}
+
+func (t *shardWriter) handleErr(err error) {
+	if err == nil {
+		return
+	}
+
+	if err == tsm1.ErrMaxBlocksExceeded {
+		t.closeTSM()
+		t.nextTSM()
+	} else {
+		t.err = err
 	}
 }
 
@@ -56,7 +116,7 @@ func (t *shardWriter) Close() {
 func (t *shardWriter) Err() error { return t.err }
 
 func (t *shardWriter) nextTSM() {
-	fileName := filepath.Join(t.path, strconv.Itoa(int(t.id)), fmt.Sprintf("%09d-%09d.%s", t.gen, t.seq, tsm1.TSMFileExtension))
+	fileName := t.fileName(t.seq)
 	t.seq++
 
 	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0666)
@@ -64,6 +124,8 @@ func (t *shardWriter) nextTSM() {
 		t.err = err
 		return
 	}
+	t.files = append(t.files, fileName)
+	t.keyBlocks = 0
 
 	// Create the writer for the new TSM file.
 	t.w, err = tsm1.NewTSMWriter(fd)
@@ -73,9 +135,27 @@ func (t *shardWriter) nextTSM() {
 	}
 }
 
+func (t *shardWriter) fileName(seq int) string {
+	ext := tsm1.TSMFileExtension
+	if t.part >= 0 {
+		ext = fmt.Sprintf("%s.%d.%s", tsm1.TSMFileExtension, t.part, tsm1.TmpTSMFileExtension)
+	}
+	return filepath.Join(t.path, strconv.Itoa(int(t.id)), fmt.Sprintf("%09d-%09d.%s", t.gen, seq, ext))
+}
+
 func (t *shardWriter) closeTSM() {
-	if err := t.w.WriteIndex(); err != nil && err != tsm1.ErrNoValues {
-		t.err = err
+	if err := t.w.WriteIndex(); err != nil {
+		if err != tsm1.ErrNoValues {
+			t.err = err
+			return
+		}
+
+		// nothing was written, so remove the empty file
+		t.files = t.files[:len(t.files)-1]
+		if err := t.w.Remove(); err != nil {
+			t.err = err
+		}
+		t.w = nil
 		return
 	}
 
@@ -85,3 +165,28 @@ func (t *shardWriter) closeTSM() {
 	}
 	t.w = nil
 }
+
+// renameShardParts renames the files written by each part of a generation in key
+// order, such that the generation consists of non-overlapping TSM files. The files are
+// numbered from the level of the generation, as the tsm1 engine targeted, that of the
+// influxdb revision in go.mod (aa61359cc74f, influxd 1.6 development), reads the level of
+// a generation from the sequence of its first file. A generation of any level may
+// therefore be written as several files.
+func renameShardParts(parts []*shardWriter) error {
+	if len(parts) == 0 {
+		return nil
+	}
+
+	final := &shardWriter{id: parts[0].id, path: parts[0].path, gen: parts[0].gen, part: -1}
+
+	seq := parts[0].cfg.Level
+	for _, p := range parts {
+		for _, name := range p.files {
+			if err := os.Rename(name, final.fileName(seq)); err != nil {
+				return err
+			}
+			seq++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package ingen
+
+import (
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// walBatchSize specifies the number of values written to each WAL entry.
+const walBatchSize = 5000
+
+// walWriter writes values to the segments of a shard's WAL, rather than TSM files,
+// in batches of walBatchSize values.
+type walWriter struct {
+	wal    *tsm1.WAL
+	values map[string][]tsm1.Value
+	n      int
+	vals   []tsm1.Value
+	err    error
+}
+
+func newWALWriter(wal *tsm1.WAL) *walWriter {
+	return &walWriter{wal: wal, values: make(map[string][]tsm1.Value)}
+}
+
+func (w *walWriter) Write(key []byte, values tsm1.Values) {
+	if w.err != nil {
+		return
+	}
+
+	k := string(key)
+	w.values[k] = append(w.values[k], values...)
+	w.n += len(values)
+	if w.n >= walBatchSize {
+		w.Flush()
+	}
+}
+
+// WriteBlock decodes block, as the WAL stores values rather than encoded blocks.
+func (w *walWriter) WriteBlock(key []byte, minTime, maxTime int64, block []byte) {
+	if w.err != nil {
+		return
+	}
+
+	w.vals, w.err = tsm1.DecodeBlock(block, w.vals[:0])
+	if w.err == nil {
+		w.Write(key, w.vals)
+	}
+}
+
+// Flush writes the pending values as a single WAL entry.
+func (w *walWriter) Flush() {
+	if w.err != nil || w.n == 0 {
+		return
+	}
+
+	_, w.err = w.wal.WriteMulti(w.values)
+	w.values = make(map[string][]tsm1.Value)
+	w.n = 0
+}
+
+func (w *walWriter) Err() error { return w.err }